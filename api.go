@@ -0,0 +1,296 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+// writeJSON encodes v as the JSON response.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Errorf("Error writing response: %s", err)
+	}
+}
+
+// apiError writes an error as JSON response.
+func apiError(w http.ResponseWriter, status int, message string) {
+	inspecRequestErrors.Inc()
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// diffHandler serves the difference between the two latest scans of a target and module.
+func diffHandler(w http.ResponseWriter, r *http.Request) {
+	if resultStore == nil {
+		apiError(w, http.StatusNotFound, "no result store configured")
+		return
+	}
+	target := r.URL.Query().Get("target")
+	module := r.URL.Query().Get("module")
+	if module == "" {
+		apiError(w, http.StatusBadRequest, "'module' parameter is missing")
+		return
+	}
+	diff, err := latestDiff(target, module)
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if diff == nil {
+		apiError(w, http.StatusNotFound, "less than two successful scans stored")
+		return
+	}
+	writeJSON(w, http.StatusOK, diff)
+}
+
+// page is a paginated API response.
+type page struct {
+	Total  int         `json:"total"`
+	Offset int         `json:"offset"`
+	Limit  int         `json:"limit"`
+	Items  interface{} `json:"items"`
+}
+
+// pagination parses the offset and limit (DEFAULT: 100) parameters and
+// returns the bounds of the requested page of total items.
+func pagination(r *http.Request, total int) (int, int, error) {
+	offset, limit := 0, 100
+	var err error
+	if value := r.URL.Query().Get("offset"); value != "" {
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("invalid offset '%s'", value)
+		}
+	}
+	if value := r.URL.Query().Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 {
+			return 0, 0, fmt.Errorf("invalid limit '%s'", value)
+		}
+	}
+	if offset > total {
+		offset = total
+	}
+	// clamp before adding, offset + limit may overflow
+	if limit > total-offset {
+		limit = total - offset
+	}
+	return offset, offset + limit, nil
+}
+
+// resultResponse is the latest scan of a target with a module.
+type resultResponse struct {
+	Target     string    `json:"target"`
+	Module     string    `json:"module"`
+	Start      time.Time `json:"start"`
+	Duration   float64   `json:"duration_seconds"`
+	ExitStatus int       `json:"exit_status"`
+	Error      string    `json:"error,omitempty"`
+	Version    string    `json:"version,omitempty"`
+	page
+}
+
+// resultsHandler serves the latest stored report of a target and module,
+// optionally filtered by the status of the controls.
+func resultsHandler(w http.ResponseWriter, r *http.Request) {
+	if resultStore == nil {
+		apiError(w, http.StatusNotFound, "no result store configured")
+		return
+	}
+	target := r.URL.Query().Get("target")
+	module := r.URL.Query().Get("module")
+	status := r.URL.Query().Get("status")
+	if module == "" {
+		apiError(w, http.StatusBadRequest, "'module' parameter is missing")
+		return
+	}
+	record, err := resultStore.Latest(target, module)
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if record == nil {
+		apiError(w, http.StatusNotFound, fmt.Sprintf("no stored result for target '%s' and module '%s'", target, module))
+		return
+	}
+
+	response := resultResponse{
+		Target:     record.Target,
+		Module:     record.Module,
+		Start:      record.Start,
+		Duration:   record.Duration,
+		ExitStatus: record.ExitStatus,
+		Error:      record.Error,
+	}
+	controls := []InspecControl{}
+	if result, err := record.Result(); err == nil {
+		response.Version = result.Output.Version
+		for _, control := range result.Output.Controls {
+			if status == "" || control.Status == status {
+				controls = append(controls, control)
+			}
+		}
+	}
+	offset, end, err := pagination(r, len(controls))
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	response.page = page{Total: len(controls), Offset: offset, Limit: end - offset, Items: controls[offset:end]}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// targetInfo lists the stored modules of a target.
+type targetInfo struct {
+	Target  string   `json:"target"`
+	Modules []string `json:"modules"`
+}
+
+// targetsHandler serves all targets with stored results.
+func targetsHandler(w http.ResponseWriter, r *http.Request) {
+	if resultStore == nil {
+		apiError(w, http.StatusNotFound, "no result store configured")
+		return
+	}
+	targets, err := resultStore.Targets()
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	sort.Strings(targets)
+	offset, end, err := pagination(r, len(targets))
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	items := []targetInfo{}
+	for _, target := range targets[offset:end] {
+		modules, err := resultStore.Modules(target)
+		if err != nil {
+			apiError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		items = append(items, targetInfo{Target: target, Modules: modules})
+	}
+	writeJSON(w, http.StatusOK, page{Total: len(targets), Offset: offset, Limit: end - offset, Items: items})
+}
+
+// moduleInfo is the config of a module.
+type moduleInfo struct {
+	Name      string   `json:"name"`
+	Path      string   `json:"path"`
+	Prefix    string   `json:"prefix"`
+	Platforms []string `json:"platforms,omitempty"`
+}
+
+// modulesHandler serves all configured modules.
+func modulesHandler(w http.ResponseWriter, r *http.Request) {
+	names, err := moduleNames()
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, "'profile_path' is not readable")
+		return
+	}
+	sort.Strings(names)
+	offset, end, err := pagination(r, len(names))
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	items := []moduleInfo{}
+	for _, name := range names[offset:end] {
+		m := loadModule(name)
+		items = append(items, moduleInfo{Name: m.name, Path: m.path, Prefix: m.prefix, Platforms: m.platforms})
+	}
+	writeJSON(w, http.StatusOK, page{Total: len(names), Offset: offset, Limit: end - offset, Items: items})
+}
+
+// scansHandler enqueues an asynchronous scan of the target and module
+// given as form or query parameters.
+func scansHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		apiError(w, http.StatusMethodNotAllowed, "only POST is allowed")
+		return
+	}
+	target := r.FormValue("target")
+	module := r.FormValue("module")
+	if module == "" {
+		apiError(w, http.StatusBadRequest, "'module' parameter is missing")
+		return
+	}
+	if !targetModuleExists(target, module) {
+		apiError(w, http.StatusBadRequest, fmt.Sprintf("Unkown module '%s'", module))
+		return
+	}
+	job, err := scanJobs.Enqueue(target, module)
+	if err != nil {
+		apiError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	w.Header().Set("Location", "/api/v1/scans/"+job.ID)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// scanHandler serves the state of a scan job on GET and cancels it on DELETE.
+func scanHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/v1/scans/")
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodDelete:
+		if !scanJobs.Cancel(id) {
+			apiError(w, http.StatusNotFound, fmt.Sprintf("Unknown scan '%s'", id))
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		apiError(w, http.StatusMethodNotAllowed, "only GET and DELETE are allowed")
+		return
+	}
+	job, ok := scanJobs.Get(id)
+	if !ok {
+		apiError(w, http.StatusNotFound, fmt.Sprintf("Unknown scan '%s'", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// exportContentTypes are the content types of the export formats.
+var exportContentTypes = map[string]string{
+	"junit": "application/xml",
+	"sarif": "application/sarif+json",
+}
+
+// exportHandler renders the latest stored scan of a target and module, or a
+// fresh one with fresh=true, in the format given by the last path element.
+func exportHandler(w http.ResponseWriter, r *http.Request) {
+	format := strings.TrimPrefix(r.URL.Path, "/api/v1/results/")
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		apiError(w, http.StatusNotFound, fmt.Sprintf("unknown format '%s'", format))
+		return
+	}
+	target := r.URL.Query().Get("target")
+	module := r.URL.Query().Get("module")
+	if module == "" {
+		apiError(w, http.StatusBadRequest, "'module' parameter is missing")
+		return
+	}
+	result, err := exportResult(target, module, r.URL.Query().Get("fresh") == "true")
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	content, err := renderResult(format, target, module, result)
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(content)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPagination(t *testing.T) {
+	for _, test := range []struct {
+		query  string
+		total  int
+		offset int
+		end    int
+		err    bool
+	}{
+		{"", 250, 0, 100, false},
+		{"?offset=240", 250, 240, 250, false},
+		{"?offset=300&limit=10", 250, 250, 250, false},
+		{"?offset=1&limit=9223372036854775807", 5, 1, 5, false},
+		{"?offset=9223372036854775807&limit=9223372036854775807", 5, 5, 5, false},
+		{"?offset=-1", 5, 0, 0, true},
+		{"?limit=0", 5, 0, 0, true},
+		{"?limit=x", 5, 0, 0, true},
+	} {
+		offset, end, err := pagination(httptest.NewRequest("GET", "/api/v1/modules"+test.query, nil), test.total)
+		if (err != nil) != test.err {
+			t.Errorf("%s: error %v", test.query, err)
+			continue
+		}
+		if offset != test.offset || end != test.end {
+			t.Errorf("%s: bounds %d:%d, want %d:%d", test.query, offset, end, test.offset, test.end)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+var bundleInstalled = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "inspec_module_bundle_installed",
+		Help: "Whether `bundle check` succeeded at startup for modules with a Gemfile.",
+	},
+	[]string{"module"},
+)
+
+func init() {
+	prometheus.MustRegister(bundleInstalled)
+}
+
+// checkBundle runs `bundle check` for the Gemfile of the module.
+func checkBundle(m *Module) error {
+	checkCommand, cleanup, err := moduleCommand(m, m.bundlePath, "check")
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	output, err := checkCommand.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("bundle check failed: %s\n%s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// checkBundles verifies the bundles of all modules with a Gemfile and
+// exports the results.
+func checkBundles() {
+	names, err := moduleNames()
+	if err != nil {
+		log.Errorf("Error listing modules: %s", err)
+		return
+	}
+	for _, name := range names {
+		m := loadModule(name)
+		if m.gemfile == "" || m.pushed || m.scanner != "inspec" {
+			continue
+		}
+		if err := checkBundle(&m); err != nil {
+			log.Errorf("Module %s: %s", name, err)
+			bundleInstalled.WithLabelValues(name).Set(0)
+			continue
+		}
+		bundleInstalled.WithLabelValues(name).Set(1)
+	}
+}
+
+// inspecCommand prepares an inspec process of the module, run with
+// `bundle exec` if the module has a Gemfile.
+func inspecCommand(m *Module, args ...string) (*exec.Cmd, func(), error) {
+	if m.gemfile == "" {
+		return moduleCommand(m, m.inspecPath, args...)
+	}
+	return moduleCommand(m, m.bundlePath, append([]string{"exec", m.inspecPath}, args...)...)
+}
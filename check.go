@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	checkConfigCommand = kingpin.Command("check-config", "Validate the config and all module profiles, exits 1 on errors.")
+	checkConfigProfile = checkConfigCommand.Flag("check-profiles", "Run `inspec check` on the profile of every module.").Default("true").Bool()
+)
+
+// checkFile reports an error if the file doesn't exist or isn't readable.
+// Private files must not be accessible by group or others.
+func checkFile(file string, private bool) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", file)
+	}
+	if private && info.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("%s has permissions %s, must not be accessible by group or others", file, info.Mode().Perm())
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// checkDir reports an error if the directory doesn't exist or isn't readable.
+func checkDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	_, err = ioutil.ReadDir(dir)
+	return err
+}
+
+// checkTransport validates the transport settings of a module.
+func checkTransport(m *Module) []error {
+	errs := []error{}
+	if m.sshPort < 0 || m.sshPort > 65535 {
+		errs = append(errs, fmt.Errorf("ssh_port %d is out of range", m.sshPort))
+	}
+	if m.sshIdentityFile != "" {
+		if err := checkFile(m.sshIdentityFile, true); err != nil {
+			errs = append(errs, fmt.Errorf("ssh_identity_file: %s", err))
+		}
+	}
+	if m.sshUser == "" && (m.sshIdentityFile != "" || m.sshPort != 0) {
+		errs = append(errs, fmt.Errorf("ssh_user is empty, but ssh settings are given"))
+	}
+	return errs
+}
+
+// checkModule validates the config and profile of a module.
+func checkModule(name string, runCheck bool) []error {
+	m := loadModule(name)
+	errs := checkTransport(&m)
+	if err := verifyModule(&m); err != nil {
+		return append(errs, err)
+	}
+	if m.pushed {
+		return errs
+	}
+	if _, ok := scanners[m.scanner]; !ok {
+		return append(errs, fmt.Errorf("unknown scanner '%s'", m.scanner))
+	}
+	if m.scanner == "oscap" {
+		return append(errs, checkOscap(&m)...)
+	}
+	if m.scanner == "goss" {
+		return append(errs, checkGoss(&m)...)
+	}
+	if m.gitRepo != "" {
+		if _, err := runGit(nil, "ls-remote", "--exit-code", m.gitRepo, m.gitRef); err != nil {
+			return append(errs, err)
+		}
+		// the profile is checked out when the exporter starts
+		if m.gitCommit == "" {
+			return errs
+		}
+	}
+	if err := checkDir(m.path); err != nil {
+		return append(errs, fmt.Errorf("path: %s", err))
+	}
+	if m.gemfile != "" {
+		if err := checkBundle(&m); err != nil {
+			return append(errs, err)
+		}
+	}
+	if runCheck {
+		checkCommand, cleanup, err := inspecCommand(&m, "check", m.path)
+		if err != nil {
+			return append(errs, err)
+		}
+		defer cleanup()
+		output, err := checkCommand.CombinedOutput()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("inspec check failed: %s\n%s", err, strings.TrimSpace(string(output))))
+		}
+	}
+	return errs
+}
+
+// checkOscap validates a module of the oscap scanner.
+func checkOscap(m *Module) []error {
+	if m.resultsFile != "" {
+		if err := checkFile(m.resultsFile, false); err != nil {
+			return []error{fmt.Errorf("results_file: %s", err)}
+		}
+		return nil
+	}
+	errs := []error{}
+	if err := checkFile(m.path, false); err != nil {
+		errs = append(errs, fmt.Errorf("path: %s", err))
+	}
+	if _, err := exec.LookPath(viper.GetString("oscap_path")); err != nil {
+		errs = append(errs, fmt.Errorf("oscap_path: %s", err))
+	}
+	return errs
+}
+
+// checkGoss validates a module of the goss scanner.
+func checkGoss(m *Module) []error {
+	errs := []error{}
+	if err := checkFile(m.path, false); err != nil && len(m.wrapper) == 0 {
+		errs = append(errs, fmt.Errorf("path: %s", err))
+	}
+	command := viper.GetString("goss_path")
+	if len(m.wrapper) > 0 {
+		command = m.wrapper[0]
+	}
+	if _, err := exec.LookPath(command); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// checkGlobal validates the global settings of the config.
+func checkGlobal() []error {
+	errs := []error{}
+	if err := checkDir(viper.GetString("profile_path")); err != nil {
+		errs = append(errs, fmt.Errorf("profile_path: %s", err))
+	}
+	if viper.IsSet("auto") {
+		auto := loadModule("auto")
+		for _, err := range checkTransport(&auto) {
+			errs = append(errs, fmt.Errorf("auto: %s", err))
+		}
+		if err := verifyModule(&auto); err != nil {
+			errs = append(errs, fmt.Errorf("auto: %s", err))
+		}
+	}
+	if flapWindow() < 0 {
+		errs = append(errs, fmt.Errorf("flapping.window: must not be negative"))
+	}
+	if viper.IsSet("store.path") {
+		if err := checkDir(viper.GetString("store.path")); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, fmt.Errorf("store.path: %s", err))
+		}
+	}
+	return errs
+}
+
+// runCheckConfig implements the check-config command and returns the exit code.
+func runCheckConfig() int {
+	if err := readConfig(); err != nil {
+		fmt.Printf("ERROR config file: %s\n", err)
+		return 1
+	}
+	fmt.Printf("Config file %s\n", viper.ConfigFileUsed())
+
+	failed := false
+	report := func(section string, errs []error) {
+		if len(errs) == 0 {
+			fmt.Printf("OK    %s\n", section)
+			return
+		}
+		failed = true
+		for _, err := range errs {
+			fmt.Printf("ERROR %s: %s\n", section, strings.Replace(err.Error(), "\n", "\n      ", -1))
+		}
+	}
+
+	report("global", checkGlobal())
+	names, err := moduleNames()
+	if err != nil {
+		report("modules", []error{err})
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		report("module "+name, checkModule(name, *checkConfigProfile))
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/prometheus/common/log"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	exportCommand = kingpin.Command("export", "Render the latest stored or a fresh scan of a target with a module.")
+	exportTarget  = exportCommand.Flag("target", "Target to export, empty for local scans.").Default("").String()
+	exportModule  = exportCommand.Flag("module", "Module to export.").Required().String()
+	exportFormat  = exportCommand.Flag("format", "Output format.").Default("junit").Enum("junit", "sarif")
+	exportFresh   = exportCommand.Flag("fresh", "Run a scan instead of using the result store.").Bool()
+)
+
+var (
+	scanCommand = kingpin.Command("scan", "Scan a target with a module and print the result, exits 1 on failed controls and 2 on errors.")
+	scanTarget  = scanCommand.Flag("target", "Target to scan, empty for a local scan.").Default("").String()
+	scanModule  = scanCommand.Flag("module", "Module to run.").Required().String()
+	scanFormat  = scanCommand.Flag("format", "Output format.").Default("prom").Enum("prom", "json", "junit", "sarif")
+)
+
+// exportResult returns the result of the target and module, either from a
+// fresh scan or the result store.
+func exportResult(target string, module string, fresh bool) (*ScanResult, error) {
+	if !moduleExists(module) {
+		return nil, fmt.Errorf("Unkown module '%s'", module)
+	}
+	if fresh {
+		m := loadModule(module)
+		result, err := executeScan(context.Background(), target, &m)
+		if resultStore != nil && result != nil {
+			if saveErr := resultStore.Save(newScanRecord(target, module, result, err)); saveErr != nil {
+				log.Errorf("Error storing result of target %s: %s", target, saveErr)
+			}
+		}
+		return result, err
+	}
+	if resultStore == nil {
+		return nil, fmt.Errorf("no result store configured")
+	}
+	record, err := resultStore.Latest(target, module)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, fmt.Errorf("no stored result for target '%s' and module '%s'", target, module)
+	}
+	return record.Result()
+}
+
+// renderResult renders the result in an export format.
+func renderResult(format string, target string, module string, result *ScanResult) ([]byte, error) {
+	switch format {
+	case "junit":
+		return renderJUnit(target, module, result)
+	case "sarif":
+		return renderSARIF(target, module, result)
+	case "json":
+		content, err := json.MarshalIndent(result.Output, "", "  ")
+		return append(content, '\n'), err
+	case "prom":
+		m := loadModule(module)
+		return gatherText(collector{target: target, module: &m, result: result})
+	}
+	return nil, fmt.Errorf("unknown format '%s'", format)
+}
+
+// runExport implements the export command and returns the exit code.
+func runExport() int {
+	result, err := exportResult(*exportTarget, *exportModule, *exportFresh)
+	if err != nil {
+		log.Errorf("Error exporting target %s: %s", *exportTarget, err)
+		return 2
+	}
+	content, err := renderResult(*exportFormat, *exportTarget, *exportModule, result)
+	if err != nil {
+		log.Errorf("Error rendering target %s: %s", *exportTarget, err)
+		return 2
+	}
+	os.Stdout.Write(content)
+	return 0
+}
+
+// runScan implements the scan command and returns the exit code.
+func runScan() int {
+	result, err := exportResult(*scanTarget, *scanModule, true)
+	if err != nil {
+		log.Errorf("Error scanning target %s: %s", *scanTarget, err)
+		return 2
+	}
+	content, err := renderResult(*scanFormat, *scanTarget, *scanModule, result)
+	if err != nil {
+		log.Errorf("Error rendering target %s: %s", *scanTarget, err)
+		return 2
+	}
+	os.Stdout.Write(content)
+	for _, status := range controlStatuses(result.Output) {
+		if status == "failed" {
+			return 1
+		}
+	}
+	return 0
+}
@@ -1,15 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"time"
 
 	"github.com/kennygrant/sanitize"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
 	"github.com/prometheus/common/log"
 
-	"encoding/json"
-	"os/exec"
 	"strings"
 
 	"github.com/spf13/viper"
@@ -18,94 +19,229 @@ import (
 type collector struct {
 	target string
 	module *Module
+	// cached serves the last stored result instead of running inspec.
+	cached bool
+	// trace records the scan for debug output, if set.
+	trace *probeTrace
+	// result is exported instead of running inspec, if set.
+	result *ScanResult
 }
 
 // Module config struct
 type Module struct {
+	name            string
 	sshUser         string
 	sshIdentityFile string
 	sshPort         int
 	needSudo        bool
 	path            string
 	prefix          string
+	platforms       []string
+	// scanner is the backend running the module, see scanners.
+	scanner string
+	// oscapProfile is the XCCDF profile evaluated by the oscap scanner.
+	oscapProfile string
+	// resultsFile is read by the oscap scanner instead of running oscap.
+	resultsFile string
+	// inspecPath is the inspec executable of the module, e.g. cinc-auditor.
+	inspecPath string
+	// env holds extra KEY=value variables of the scanner process.
+	env []string
+	// workDir is the working directory of the scanner process.
+	workDir string
+	// gemfile runs inspec with `bundle exec` of bundlePath in this bundle.
+	gemfile    string
+	bundlePath string
+	// gitRepo and gitRef back the profile of the module, checked out at gitCommit.
+	gitRepo   string
+	gitRef    string
+	gitCommit string
+	// isolateHome runs every scanner process with its own temporary HOME.
+	isolateHome bool
+	// wrapper prefixes the goss command line, {target} is replaced by the target.
+	wrapper []string
+	// pushed modules serve reports of /api/v1/reports instead of running inspec.
+	pushed bool
+	// maxAge is the age after which pushed reports are stale.
+	maxAge time.Duration
 }
 
-//InspecOutput Inspec json-min reporter response struct
+// InspecControl is a single result of the inspec json-min reporter. Title,
+// Desc, Impact and Tags of the control are only known from the json reporter.
+type InspecControl struct {
+	ID            string                 `json:"id"`
+	ProfileID     string                 `json:"profile_id"`
+	ProfileSha256 string                 `json:"profile_sha256"`
+	Status        string                 `json:"status"`
+	CodeDesc      string                 `json:"code_desc"`
+	Message       string                 `json:"message,omitempty"`
+	SkipMessage   string                 `json:"skip_message,omitempty"`
+	Resource      string                 `json:"resource,omitempty"`
+	Title         string                 `json:"title,omitempty"`
+	Desc          string                 `json:"desc,omitempty"`
+	Impact        float64                `json:"impact,omitempty"`
+	Tags          map[string]interface{} `json:"tags,omitempty"`
+}
+
+// InspecOutput Inspec json-min reporter response struct, see ParseInspecReport for the json reporter
 type InspecOutput struct {
-	Controls []struct {
-		ID            string `json:"id"`
-		ProfileID     string `json:"profile_id"`
-		ProfileSha256 string `json:"profile_sha256"`
-		Status        string `json:"status"`
-		CodeDesc      string `json:"code_desc"`
-		Message       string `json:"message,omitempty"`
-		SkipMessage   string `json:"skip_message,omitempty"`
-		Resource      string `json:"resource,omitempty"`
-	} `json:"controls"`
+	Controls   []InspecControl `json:"controls"`
 	Statistics struct {
 		Duration float64 `json:"duration"`
 	} `json:"statistics"`
 	Version string `json:"version"`
 }
 
-// ScrapeTarget implements Prometheus.Collector.
+// ScanResult is a single run of inspec against a target.
+type ScanResult struct {
+	Output        InspecOutput
+	Raw           []byte
+	Stderr        []byte
+	Args          []string
+	ExitCode      int
+	Start         time.Time
+	Duration      time.Duration
+	ParseDuration time.Duration
+}
+
+// ScrapeTarget runs the profile of the module against the target and returns the parsed report.
 func ScrapeTarget(target string, config *Module) (InspecOutput, error) {
+	result, err := executeScan(context.Background(), target, config)
+	if err != nil {
+		return InspecOutput{}, err
+	}
+	return result.Output, nil
+}
+
+// RunInspec runs the profile of the module against the target. The result is
+// returned along with the error whenever inspec was started. Cancelling the
+// context kills inspec.
+func RunInspec(ctx context.Context, target string, config *Module) (*ScanResult, error) {
 	inspecArgs := []string{
 		"exec",
 		config.path,
 		"--reporter",
-		"json-min",
+		"json",
 	}
-	if target != "" {
-		inspecArgs = append(inspecArgs,
-			"-t",
-			fmt.Sprintf("ssh://%v@%v:%v", config.sshUser, target, config.sshPort),
-			"-i",
-			config.sshIdentityFile)
+	inspecArgs = append(inspecArgs, transportArgs(target, config)...)
 
-		if config.needSudo {
-			inspecArgs = append(inspecArgs, "--sudo")
-		}
+	inspecCommand, cleanup, err := inspecCommand(config, inspecArgs...)
+	if err != nil {
+		return nil, err
 	}
+	defer cleanup()
+	log.Debugf("Running %v", redactArgs(inspecCommand.Args))
+	var stdout, stderr bytes.Buffer
+	inspecCommand.Stdout = &stdout
+	inspecCommand.Stderr = &stderr
+	result := &ScanResult{Start: time.Now(), Args: inspecCommand.Args}
+	err = runCommand(ctx, inspecCommand)
+	result.Duration = time.Since(result.Start)
+	inspecOutput := stdout.Bytes()
+	result.Raw = inspecOutput
+	result.Stderr = stderr.Bytes()
+	result.ExitCode = exitCode(err)
 
-	var inspecData InspecOutput
-	inspecCommand := exec.Command(viper.GetString("inspec_path"), inspecArgs...)
-	fmt.Printf("%v", inspecCommand.Args)
-	inspecOutput, err := inspecCommand.CombinedOutput()
-
-	if err != nil && err.Error() != "exit status 100" {
-		return inspecData, err
-		//log.Fatalf("inspecCommand.Run() failed with %s", err)
+	if err != nil && result.ExitCode != 100 {
+		return result, err
 	}
 
-	err = json.Unmarshal(inspecOutput, &inspecData)
+	parseStart := time.Now()
+	result.Output, err = ParseInspecReport(inspecOutput)
+	result.ParseDuration = time.Since(parseStart)
 	if err != nil {
-		return inspecData, err
-		//log.Fatalf("inspec Output convertion failed with %s", err)
+		return result, fmt.Errorf("parsing inspec output failed: %s", err)
+	}
+	return result, nil
+}
+
+// transportArgs returns the inspec arguments to connect to the target with
+// the transport settings of the module. An empty target means local execution.
+func transportArgs(target string, config *Module) []string {
+	if target == "" {
+		return nil
 	}
-	return inspecData, nil
+	args := []string{
+		"-t",
+		fmt.Sprintf("ssh://%v@%v:%v", config.sshUser, target, config.sshPort),
+		"-i",
+		config.sshIdentityFile,
+	}
+	if config.needSudo {
+		args = append(args, "--sudo")
+	}
+	return args
 }
 
 // Describe implements Prometheus.Collector.
+// The collector is unchecked, so several modules can share one registry.
 func (c collector) Describe(ch chan<- *prometheus.Desc) {
-	ch <- prometheus.NewDesc("dummy", "dummy", nil, nil)
 }
 
 // Collect implements Prometheus.Collector.
 func (c collector) Collect(ch chan<- prometheus.Metric) {
-	start := time.Now()
-	inspecData, err := ScrapeTarget(c.target, c.module)
+	var (
+		result *ScanResult
+		err    error
+	)
+	if c.result != nil {
+		result = c.result
+	} else if c.cached || c.module.pushed {
+		result, err = c.lastResult()
+		if err == nil && c.module.pushed && !c.collectStaleness(ch, result) {
+			return
+		}
+	} else {
+		result, err = executeScan(context.Background(), c.target, c.module)
+		if resultStore != nil && result != nil {
+			if saveErr := resultStore.Save(newScanRecord(c.target, c.module.name, result, err)); saveErr != nil {
+				log.Errorf("Error storing result of target %s: %s", c.target, saveErr)
+			}
+		}
+	}
+	if c.trace != nil {
+		c.trace.add(c.module.name, result, err)
+	}
 	if err != nil {
 		log.Infof("Error scraping target %s: %s", c.target, err)
 		ch <- prometheus.NewInvalidMetric(prometheus.NewDesc("inspec_error", "Error scraping target", nil, nil), err)
 		return
 	}
+
+	var (
+		records []*ScanRecord
+		outputs []InspecOutput
+	)
+	if resultStore != nil {
+		// one more record than the window for the diff
+		history, err := resultStore.Window(c.target, c.module.name, flapWindow(), 2)
+		if err != nil {
+			log.Errorf("Error reading history of target %s: %s", c.target, err)
+		}
+		records, outputs = successfulOutputs(history)
+	}
+	flaps, flapping := flapState(records, outputs)
+	suppressed := map[string]bool{}
+	if viper.GetBool("flapping.suppress") {
+		suppressed = flapping
+	}
+	c.collectResult(ch, result, suppressed)
+	if len(records) > 0 {
+		c.collectHistory(ch, records, outputs, flaps, flapping)
+	}
+}
+
+// collectResult exports the metrics of a scan result. Failed checks of
+// controls in suppressed are not counted in the failed total.
+func (c collector) collectResult(ch chan<- prometheus.Metric, result *ScanResult, suppressed map[string]bool) {
+	inspecData := result.Output
 	ch <- prometheus.MustNewConstMetric(
 		prometheus.NewDesc(c.module.prefix+"total_returned", "Total number of inspec tests returned from scrape process.", nil, nil),
 		prometheus.GaugeValue,
 		float64(len(inspecData.Controls)))
 
 	passed := 0
+	failed := 0
 	duplicate := 0
 	descs := []string{}
 	for _, check := range inspecData.Controls {
@@ -117,6 +253,9 @@ func (c collector) Collect(ch chan<- prometheus.Metric) {
 			if isPassed(check.Status) > 0 {
 				passed++
 			}
+			if check.Status == "failed" && !suppressed[controlKey(check.ProfileID, check.ID)] {
+				failed++
+			}
 			descs = append(descs, normalize(check.CodeDesc))
 		} else {
 			duplicate++
@@ -128,15 +267,78 @@ func (c collector) Collect(ch chan<- prometheus.Metric) {
 		prometheus.GaugeValue,
 		float64(passed))
 
+	ch <- prometheus.MustNewConstMetric(
+		prometheus.NewDesc(c.module.prefix+"total_failed", "Total number of failed inspec tests returned from scrape process, without suppressed flapping controls.", nil, nil),
+		prometheus.GaugeValue,
+		float64(failed))
+
 	ch <- prometheus.MustNewConstMetric(
 		prometheus.NewDesc(c.module.prefix+"duplicates", "Total number of duplicate inspec tests returned from scrape process.", nil, nil),
 		prometheus.GaugeValue,
 		float64(duplicate))
 
 	ch <- prometheus.MustNewConstMetric(
-		prometheus.NewDesc("inspec_scrape_duration_seconds", "Time inspec took.", nil, nil),
+		prometheus.NewDesc("inspec_scrape_duration_seconds", "Time inspec took.", []string{"module"}, nil),
+		prometheus.GaugeValue,
+		result.Duration.Seconds(),
+		c.module.name)
+
+	ch <- prometheus.MustNewConstMetric(
+		prometheus.NewDesc("inspec_last_scan_timestamp_seconds", "Unix time of the scan the metrics are based on.", []string{"module"}, nil),
+		prometheus.GaugeValue,
+		float64(result.Start.Unix()),
+		c.module.name)
+}
+
+// gatherText collects the metrics of the collector and encodes them in the
+// text exposition format.
+func gatherText(c collector) ([]byte, error) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+	families, err := registry.Gather()
+	if err != nil {
+		return nil, err
+	}
+	var buffer bytes.Buffer
+	for _, family := range families {
+		if _, err := expfmt.MetricFamilyToText(&buffer, family); err != nil {
+			return nil, err
+		}
+	}
+	return buffer.Bytes(), nil
+}
+
+// collectStaleness exports the age of a pushed report and whether it is
+// stale. It returns false for stale reports, whose results are not exported.
+func (c collector) collectStaleness(ch chan<- prometheus.Metric, result *ScanResult) bool {
+	age := time.Since(result.Start)
+	ch <- prometheus.MustNewConstMetric(
+		prometheus.NewDesc("inspec_report_age_seconds", "Age of the latest pushed report.", []string{"module"}, nil),
 		prometheus.GaugeValue,
-		float64(time.Since(start).Seconds()))
+		age.Seconds(),
+		c.module.name)
+	stale := age > c.module.maxAge
+	ch <- prometheus.MustNewConstMetric(
+		prometheus.NewDesc("inspec_report_stale", "Whether the latest pushed report is older than its max age.", []string{"module"}, nil),
+		prometheus.GaugeValue,
+		boolToFloat(stale),
+		c.module.name)
+	return !stale
+}
+
+// lastResult returns the latest stored result of the target and module.
+func (c collector) lastResult() (*ScanResult, error) {
+	if resultStore == nil {
+		return nil, fmt.Errorf("no result store configured")
+	}
+	record, err := resultStore.Latest(c.target, c.module.name)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, fmt.Errorf("no stored result for target '%s' and module '%s'", c.target, c.module.name)
+	}
+	return record.Result()
 }
 
 func index(vs []string, t string) int {
@@ -159,6 +361,13 @@ func normalize(desc string) string {
 				sanitize.Name(strings.Replace(desc, "/", "_", -1)), "-", "_", -1), "_.", "_dot", -1), ".", "_", -1)
 }
 
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
 func isPassed(passed string) float64 {
 	if passed == "passed" {
 		return float64(1)
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/prometheus/common/log"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	convertCommand = kingpin.Command("convert", "Convert a saved inspec json or json-min report to Prometheus metrics.")
+	convertFile    = convertCommand.Arg("file", "Report file, stdin if omitted or '-'.").Default("-").String()
+	convertModule  = convertCommand.Flag("module", "Module of the report (DEFAULT: profile of the report).").String()
+	convertTarget  = convertCommand.Flag("target", "Target of the report.").Default("").String()
+)
+
+// ConvertReport reads an inspec json or json-min report and returns the
+// metrics the collector would produce for it in the text exposition format.
+func ConvertReport(r io.Reader, target string, m *Module) ([]byte, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	output, err := ParseInspecReport(data)
+	if err != nil {
+		return nil, err
+	}
+	result := &ScanResult{
+		Output:   output,
+		Raw:      data,
+		Start:    time.Now(),
+		Duration: time.Duration(output.Statistics.Duration * float64(time.Second)),
+	}
+	return gatherText(collector{target: target, module: m, result: result})
+}
+
+// runConvert implements the convert command and returns the exit code. The
+// config is optional and only used for the settings of the module.
+func runConvert() int {
+	if err := readConfig(); err != nil {
+		log.Debugf("No config used: %s", err)
+	}
+
+	input := os.Stdin
+	if *convertFile != "-" {
+		file, err := os.Open(*convertFile)
+		if err != nil {
+			log.Errorf("Error opening report: %s", err)
+			return 2
+		}
+		defer file.Close()
+		input = file
+	}
+	data, err := ioutil.ReadAll(input)
+	if err != nil {
+		log.Errorf("Error reading report: %s", err)
+		return 2
+	}
+
+	module := *convertModule
+	if module == "" {
+		output, err := ParseInspecReport(data)
+		if err != nil {
+			log.Errorf("Error parsing report: %s", err)
+			return 2
+		}
+		if len(output.Controls) > 0 {
+			module = output.Controls[0].ProfileID
+		}
+	}
+	m := loadModule(module)
+	content, err := ConvertReport(bytes.NewReader(data), *convertTarget, &m)
+	if err != nil {
+		log.Errorf("Error converting report: %s", err)
+		return 2
+	}
+	os.Stdout.Write(content)
+	return 0
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+// secretFlags are inspec flags whose value is hidden in debug output.
+var secretFlags = map[string]bool{
+	"--password":      true,
+	"--sudo-password": true,
+	"--winrm-pass":    true,
+}
+
+// redactArgs hides passwords in the inspec command line.
+func redactArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		redacted[i] = arg
+		if i > 0 && secretFlags[args[i-1]] {
+			redacted[i] = "<redacted>"
+			continue
+		}
+		if parts := strings.SplitN(arg, "=", 2); len(parts) == 2 && secretFlags[parts[0]] {
+			redacted[i] = parts[0] + "=<redacted>"
+			continue
+		}
+		if u, err := url.Parse(arg); err == nil && u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				u.User = url.UserPassword(u.User.Username(), "redacted")
+				redacted[i] = u.String()
+			}
+		}
+	}
+	return redacted
+}
+
+// scanTrace is a scan recorded for debug output.
+type scanTrace struct {
+	module string
+	result *ScanResult
+	err    error
+}
+
+// probeTrace records the scans of a probe with debug=true.
+type probeTrace struct {
+	mutex sync.Mutex
+	scans []scanTrace
+}
+
+func (t *probeTrace) add(module string, result *ScanResult, err error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.scans = append(t.scans, scanTrace{module: module, result: result, err: err})
+}
+
+// write gathers the registry and writes the plain text trace of the probe
+// followed by the metrics that would have been returned.
+func (t *probeTrace) write(w http.ResponseWriter, target string, module string, registry *prometheus.Registry) {
+	start := time.Now()
+	families, gatherErr := registry.Gather()
+	gatherDuration := time.Since(start)
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "Target: %q\nModule: %q\n", target, module)
+
+	t.mutex.Lock()
+	for _, scan := range t.scans {
+		fmt.Fprintf(w, "\n=== Module %s ===\n", scan.module)
+		if scan.result == nil {
+			fmt.Fprintf(w, "Error: %s\n", scan.err)
+			continue
+		}
+		result := scan.result
+		if len(result.Args) > 0 {
+			fmt.Fprintf(w, "Command: %s\n", strings.Join(redactArgs(result.Args), " "))
+		}
+		fmt.Fprintf(w, "Exit code: %d\n", result.ExitCode)
+		fmt.Fprintf(w, "Started: %s\n", result.Start.Format(time.RFC3339))
+		fmt.Fprintf(w, "Execution time: %s\n", result.Duration)
+		fmt.Fprintf(w, "Parse time: %s\n", result.ParseDuration)
+		if scan.err != nil {
+			fmt.Fprintf(w, "Error: %s\n", scan.err)
+		} else {
+			fmt.Fprintf(w, "Controls: %d\n", len(result.Output.Controls))
+		}
+		fmt.Fprintf(w, "Stderr:\n%s\n", indent(string(result.Stderr)))
+	}
+	t.mutex.Unlock()
+
+	fmt.Fprintf(w, "\nGather time: %s\n", gatherDuration)
+	if gatherErr != nil {
+		fmt.Fprintf(w, "Gather error:\n%s\n", indent(gatherErr.Error()))
+	}
+	fmt.Fprintf(w, "\nMetrics that would have been returned:\n")
+	for _, family := range families {
+		expfmt.MetricFamilyToText(w, family)
+	}
+}
+
+// indent prefixes every line of text.
+func indent(text string) string {
+	text = strings.TrimRight(text, "\n")
+	if text == "" {
+		return "  <empty>"
+	}
+	return "  " + strings.Replace(text, "\n", "\n  ", -1)
+}
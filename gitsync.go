@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+	"github.com/spf13/viper"
+)
+
+// gitCheckout is a checked out commit of a git-backed module.
+type gitCheckout struct {
+	dir    string
+	commit string
+}
+
+var (
+	// gitSyncMutex serializes the syncs of all modules.
+	gitSyncMutex sync.Mutex
+	gitMutex     sync.Mutex
+	gitCheckouts = map[string]gitCheckout{}
+	// gitInfoLabels are the labels of the info metric of each module.
+	gitInfoLabels = map[string]prometheus.Labels{}
+)
+
+var (
+	gitInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "inspec_module_git_info",
+			Help: "Checked out commit of git-backed modules.",
+		},
+		[]string{"module", "repo", "ref", "commit"},
+	)
+	gitSyncErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "inspec_module_git_sync_errors_total",
+			Help: "Failed syncs of git-backed modules.",
+		},
+		[]string{"module"},
+	)
+	gitLastSync = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "inspec_module_git_last_sync_timestamp_seconds",
+			Help: "Unix time of the last successful sync of git-backed modules.",
+		},
+		[]string{"module"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(gitInfo)
+	prometheus.MustRegister(gitSyncErrors)
+	prometheus.MustRegister(gitLastSync)
+}
+
+// gitCacheDir returns git.cache_dir (DEFAULT: inspec_exporter_git in the
+// temporary directory).
+func gitCacheDir() string {
+	if viper.IsSet("git.cache_dir") {
+		return viper.GetString("git.cache_dir")
+	}
+	return filepath.Join(os.TempDir(), "inspec_exporter_git")
+}
+
+func gitModuleDir(name string) string {
+	return filepath.Join(gitCacheDir(), url.PathEscape(name))
+}
+
+// runGit runs git with the extra environment and returns its output. It is
+// killed after git.timeout (DEFAULT: 5m).
+func runGit(env []string, args ...string) ([]byte, error) {
+	timeout := 5 * time.Minute
+	if viper.IsSet("git.timeout") {
+		timeout = viper.GetDuration("git.timeout")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	gitCommand := exec.Command(viper.GetString("git_path"), args...)
+	gitCommand.Env = append(os.Environ(), env...)
+	setProcessGroup(gitCommand)
+	var stdout, stderr bytes.Buffer
+	gitCommand.Stdout = &stdout
+	gitCommand.Stderr = &stderr
+	err := runCommand(ctx, gitCommand)
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("%v: timed out after %s", redactArgs(gitCommand.Args), timeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s: %s", redactArgs(gitCommand.Args), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// syncGit fetches the ref of the module into a bare repository in its cache
+// dir and checks the commit out into a directory of its own. When the commit
+// changes, the previous checkout is kept for running scans and older ones are
+// removed.
+func syncGit(m *Module) (gitCheckout, error) {
+	base := gitModuleDir(m.name)
+	repo := filepath.Join(base, "repo.git")
+	if _, err := os.Stat(repo); os.IsNotExist(err) {
+		if err := os.MkdirAll(base, 0750); err != nil {
+			return gitCheckout{}, err
+		}
+		if _, err := runGit(nil, "init", "--quiet", "--bare", repo); err != nil {
+			return gitCheckout{}, err
+		}
+	}
+	if _, err := runGit(nil, "--git-dir", repo, "fetch", "--quiet", "--force", m.gitRepo, m.gitRef); err != nil {
+		return gitCheckout{}, err
+	}
+	output, err := runGit(nil, "--git-dir", repo, "rev-parse", "FETCH_HEAD^{commit}")
+	if err != nil {
+		return gitCheckout{}, err
+	}
+	checkout := gitCheckout{commit: strings.TrimSpace(string(output))}
+	checkout.dir = filepath.Join(base, checkout.commit)
+
+	if _, err := os.Stat(checkout.dir); os.IsNotExist(err) {
+		tmp, err := ioutil.TempDir(base, ".checkout")
+		if err != nil {
+			return gitCheckout{}, err
+		}
+		// a separate index keeps concurrent checkouts of the repository apart
+		index := tmp + ".index"
+		defer os.Remove(index)
+		_, err = runGit([]string{"GIT_INDEX_FILE=" + index}, "--git-dir", repo, "--work-tree", tmp, "checkout", "--force", checkout.commit, "--", ".")
+		if err == nil {
+			err = os.Rename(tmp, checkout.dir)
+		}
+		if err != nil {
+			os.RemoveAll(tmp)
+			return gitCheckout{}, err
+		}
+	}
+
+	previous := readGitCurrent(base)
+	if previous == checkout.commit {
+		return checkout, nil
+	}
+	if err := writeFileAtomic(filepath.Join(base, "current"), []byte(checkout.commit+"\n")); err != nil {
+		return gitCheckout{}, err
+	}
+	entries, err := ioutil.ReadDir(base)
+	if err != nil {
+		return checkout, err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() && name != "repo.git" && name != checkout.commit && name != previous {
+			if err := os.RemoveAll(filepath.Join(base, name)); err != nil {
+				log.Errorf("Error removing old checkout of module %s: %s", m.name, err)
+			}
+		}
+	}
+	return checkout, nil
+}
+
+// readGitCurrent returns the commit of the last good checkout in base.
+func readGitCurrent(base string) string {
+	content, err := ioutil.ReadFile(filepath.Join(base, "current"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+// currentCheckout returns the last good checkout of the module, falling back
+// to the one on disk from before a restart. It is empty if there is none.
+func currentCheckout(name string) gitCheckout {
+	gitMutex.Lock()
+	defer gitMutex.Unlock()
+	if checkout, ok := gitCheckouts[name]; ok {
+		return checkout
+	}
+	base := gitModuleDir(name)
+	commit := readGitCurrent(base)
+	if commit == "" {
+		return gitCheckout{}
+	}
+	checkout := gitCheckout{dir: filepath.Join(base, commit), commit: commit}
+	if _, err := os.Stat(checkout.dir); err != nil {
+		return gitCheckout{}
+	}
+	gitCheckouts[name] = checkout
+	return checkout
+}
+
+// setGitInfo exports the checked out commit of the module.
+func setGitInfo(m *Module, commit string) {
+	gitMutex.Lock()
+	defer gitMutex.Unlock()
+	if labels, ok := gitInfoLabels[m.name]; ok {
+		gitInfo.Delete(labels)
+	}
+	labels := prometheus.Labels{"module": m.name, "repo": m.gitRepo, "ref": m.gitRef, "commit": commit}
+	gitInfo.With(labels).Set(1)
+	gitInfoLabels[m.name] = labels
+}
+
+// updateGitModule syncs the module and exports the result. The module keeps
+// its last good checkout if the sync fails. gitSyncMutex must be held.
+func updateGitModule(m *Module) error {
+	checkout, err := syncGit(m)
+	if err != nil {
+		gitSyncErrors.WithLabelValues(m.name).Inc()
+		current := currentCheckout(m.name)
+		if current.commit == "" {
+			return err
+		}
+		setGitInfo(m, current.commit)
+		return fmt.Errorf("keeping commit %s: %s", current.commit, err)
+	}
+	gitMutex.Lock()
+	gitCheckouts[m.name] = checkout
+	gitMutex.Unlock()
+	setGitInfo(m, checkout.commit)
+	gitLastSync.WithLabelValues(m.name).SetToCurrentTime()
+	log.Debugf("Module %s is at commit %s", m.name, checkout.commit)
+	return nil
+}
+
+// syncGitModules syncs all git-backed modules.
+func syncGitModules() {
+	names, err := moduleNames()
+	if err != nil {
+		log.Errorf("Error listing modules: %s", err)
+		return
+	}
+	for _, name := range names {
+		m := loadModule(name)
+		if m.gitRepo == "" {
+			continue
+		}
+		gitSyncMutex.Lock()
+		err := updateGitModule(&m)
+		gitSyncMutex.Unlock()
+		if err != nil {
+			log.Errorf("Error syncing module %s: %s", name, err)
+		}
+	}
+}
+
+// ensureCheckout syncs a git-backed module without a checkout, so commands
+// only wait for the git modules they use.
+func ensureCheckout(m *Module) error {
+	if m.gitRepo == "" || m.gitCommit != "" {
+		return nil
+	}
+	gitSyncMutex.Lock()
+	var err error
+	// another scan may have synced the module meanwhile
+	if currentCheckout(m.name).commit == "" {
+		err = updateGitModule(m)
+	}
+	gitSyncMutex.Unlock()
+	*m = loadModule(m.name)
+	if m.gitCommit == "" {
+		return fmt.Errorf("module '%s' has no checkout of %s: %s", m.name, m.gitRepo, err)
+	}
+	return nil
+}
+
+// syncGitLoop syncs the git-backed modules at startup and then every
+// git.interval (DEFAULT: 15m).
+func syncGitLoop() {
+	syncGitModules()
+	interval := 15 * time.Minute
+	if viper.IsSet("git.interval") {
+		interval = viper.GetDuration("git.interval")
+	}
+	if interval <= 0 {
+		return
+	}
+	for range time.Tick(interval) {
+		syncGitModules()
+	}
+}
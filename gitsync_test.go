@@ -0,0 +1,163 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// gitFixture is a bare repository with a work tree to commit to it.
+type gitFixture struct {
+	t    *testing.T
+	root string
+	bare string
+	work string
+}
+
+func newGitFixture(t *testing.T) *gitFixture {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	root, err := ioutil.TempDir("", "inspec_exporter_git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &gitFixture{t: t, root: root, bare: filepath.Join(root, "profiles.git"), work: filepath.Join(root, "work")}
+	f.git(root, "init", "--quiet", "--bare", f.bare)
+	f.git(root, "init", "--quiet", f.work)
+
+	viper.Reset()
+	viper.Set("git_path", "git")
+	viper.Set("git.cache_dir", filepath.Join(root, "cache"))
+	gitCheckouts = map[string]gitCheckout{}
+	return f
+}
+
+func (f *gitFixture) git(dir string, args ...string) string {
+	cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		f.t.Fatalf("git %v: %s\n%s", args, err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// commit adds a file to the profile and pushes it to the main branch.
+func (f *gitFixture) commit(file string) string {
+	if err := ioutil.WriteFile(filepath.Join(f.work, file), []byte(file), 0640); err != nil {
+		f.t.Fatal(err)
+	}
+	f.git(f.work, "add", file)
+	f.git(f.work, "commit", "--quiet", "-m", file)
+	f.git(f.work, "push", "--quiet", f.bare, "HEAD:refs/heads/main")
+	return f.git(f.work, "rev-parse", "HEAD")
+}
+
+func (f *gitFixture) module() *Module {
+	return &Module{name: "profile", gitRepo: f.bare, gitRef: "main"}
+}
+
+func (f *gitFixture) close() {
+	viper.Reset()
+	gitCheckouts = map[string]gitCheckout{}
+	os.RemoveAll(f.root)
+}
+
+func TestSyncGitClonesAndFetches(t *testing.T) {
+	f := newGitFixture(t)
+	defer f.close()
+
+	first := f.commit("inspec.yml")
+	checkout, err := syncGit(f.module())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkout.commit != first {
+		t.Errorf("commit = %s, want %s", checkout.commit, first)
+	}
+	if _, err := os.Stat(filepath.Join(checkout.dir, "inspec.yml")); err != nil {
+		t.Errorf("profile not checked out: %s", err)
+	}
+
+	second := f.commit("controls.rb")
+	checkout, err = syncGit(f.module())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkout.commit != second {
+		t.Errorf("commit = %s, want %s", checkout.commit, second)
+	}
+	if _, err := os.Stat(filepath.Join(checkout.dir, "controls.rb")); err != nil {
+		t.Errorf("new commit not checked out: %s", err)
+	}
+}
+
+func TestUpdateGitModuleKeepsLastGoodCheckout(t *testing.T) {
+	f := newGitFixture(t)
+	defer f.close()
+
+	commit := f.commit("inspec.yml")
+	if err := updateGitModule(f.module()); err != nil {
+		t.Fatal(err)
+	}
+	broken := f.module()
+	broken.gitRepo = filepath.Join(f.root, "missing.git")
+	if err := updateGitModule(broken); err == nil {
+		t.Fatal("sync of a missing repository succeeded")
+	}
+	checkout := currentCheckout("profile")
+	if checkout.commit != commit {
+		t.Errorf("commit after failed sync = '%s', want %s", checkout.commit, commit)
+	}
+	if _, err := os.Stat(filepath.Join(checkout.dir, "inspec.yml")); err != nil {
+		t.Errorf("last good checkout removed: %s", err)
+	}
+
+	// a restart falls back to the checkout on disk
+	gitCheckouts = map[string]gitCheckout{}
+	if checkout := currentCheckout("profile"); checkout.commit != commit {
+		t.Errorf("commit after restart = '%s', want %s", checkout.commit, commit)
+	}
+}
+
+func TestSyncGitPrunesOldCheckouts(t *testing.T) {
+	f := newGitFixture(t)
+	defer f.close()
+
+	commits := []string{}
+	for _, file := range []string{"a.rb", "b.rb", "c.rb"} {
+		commits = append(commits, f.commit(file))
+		if _, err := syncGit(f.module()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// syncing the same commit again must not remove the previous one
+	if _, err := syncGit(f.module()); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := ioutil.ReadDir(gitModuleDir("profile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirs := map[string]bool{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			dirs[entry.Name()] = true
+		}
+	}
+	if dirs[commits[0]] {
+		t.Errorf("old checkout %s was not removed", commits[0])
+	}
+	for _, commit := range commits[1:] {
+		if !dirs[commit] {
+			t.Errorf("checkout %s was removed, have %v", commit, dirs)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/log"
+	"github.com/spf13/viper"
+)
+
+// gossOutput is the response of `goss validate --format json`.
+type gossOutput struct {
+	Results []struct {
+		ResourceType string      `json:"resource-type"`
+		ResourceID   string      `json:"resource-id"`
+		Property     string      `json:"property"`
+		Title        string      `json:"title"`
+		Meta         interface{} `json:"meta"`
+		Result       int         `json:"result"`
+		Skipped      bool        `json:"skipped"`
+		Successful   bool        `json:"successful"`
+		SummaryLine  string      `json:"summary-line"`
+		Err          interface{} `json:"err"`
+	} `json:"results"`
+	Summary struct {
+		FailedCount   int   `json:"failed-count"`
+		TestCount     int   `json:"test-count"`
+		TotalDuration int64 `json:"total-duration"`
+	} `json:"summary"`
+}
+
+// ParseGossResults maps the results of goss to the control model of inspec.
+// Every resource becomes a control and every tested property a result.
+func ParseGossResults(data []byte, profile string) (InspecOutput, error) {
+	var output InspecOutput
+	var goss gossOutput
+	if err := json.Unmarshal(data, &goss); err != nil {
+		return output, err
+	}
+	output.Controls = []InspecControl{}
+	for _, result := range goss.Results {
+		control := InspecControl{
+			ID:        result.ResourceType + " " + result.ResourceID,
+			ProfileID: profile,
+			CodeDesc:  fmt.Sprintf("%s %s %s", result.ResourceType, result.ResourceID, result.Property),
+			Resource:  result.ResourceType,
+			Title:     result.Title,
+		}
+		if meta, ok := result.Meta.(map[string]interface{}); ok {
+			control.Tags = meta
+		}
+		switch {
+		case result.Skipped:
+			control.Status = "skipped"
+			control.SkipMessage = result.SummaryLine
+		case result.Successful:
+			control.Status = "passed"
+		default:
+			control.Status = "failed"
+			control.Message = result.SummaryLine
+			if result.Err != nil {
+				control.Message = fmt.Sprintf("%s\n%v", control.Message, result.Err)
+			}
+		}
+		output.Controls = append(output.Controls, control)
+	}
+	output.Statistics.Duration = time.Duration(goss.Summary.TotalDuration).Seconds()
+	return output, nil
+}
+
+// gossArgs returns the command line of goss, prefixed by the wrapper of the
+// module with {target} replaced by the target.
+func gossArgs(target string, config *Module) ([]string, error) {
+	args := []string{}
+	if len(config.wrapper) == 0 && target != "" {
+		return nil, fmt.Errorf("module '%s' needs a wrapper to run goss on targets", config.name)
+	}
+	for _, arg := range config.wrapper {
+		args = append(args, strings.Replace(arg, "{target}", target, -1))
+	}
+	return append(args, viper.GetString("goss_path"), "--gossfile", config.path, "validate", "--format", "json"), nil
+}
+
+// RunGoss validates the gossfile in the path of the module, locally or with
+// the wrapper of the module.
+func RunGoss(ctx context.Context, target string, config *Module) (*ScanResult, error) {
+	args, err := gossArgs(target, config)
+	if err != nil {
+		return nil, err
+	}
+	gossCommand, cleanup, err := moduleCommand(config, args[0], args[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	log.Debugf("Running %v", redactArgs(gossCommand.Args))
+	var stdout, stderr bytes.Buffer
+	gossCommand.Stdout = &stdout
+	gossCommand.Stderr = &stderr
+	result := &ScanResult{Start: time.Now(), Args: gossCommand.Args}
+	err = runCommand(ctx, gossCommand)
+	gossOutput := stdout.Bytes()
+	result.Duration = time.Since(result.Start)
+	result.Stderr = stderr.Bytes()
+	result.ExitCode = exitCode(err)
+	// goss exits with 1 if a test failed
+	if err != nil && result.ExitCode != 1 {
+		return result, fmt.Errorf("%s: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	parseStart := time.Now()
+	result.Output, err = ParseGossResults(gossOutput, strings.TrimSuffix(filepath.Base(config.path), filepath.Ext(config.path)))
+	result.ParseDuration = time.Since(parseStart)
+	if err != nil {
+		return result, fmt.Errorf("parsing goss output failed: %s", err)
+	}
+	return result, storeMappedOutput(result)
+}
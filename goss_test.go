@@ -0,0 +1,63 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+const gossResults = `{
+  "results": [
+    {"resource-type": "Service", "resource-id": "sshd", "property": "running", "title": "sshd runs",
+     "meta": {"severity": "high", "owner": "ops"}, "successful": true, "summary-line": "Service: sshd: running: matches expectation: [true]"},
+    {"resource-type": "Port", "resource-id": "tcp:23", "property": "listening",
+     "successful": false, "summary-line": "Port: tcp:23: listening:\nExpected\n    <bool>: true\nto equal\n    <bool>: false"},
+    {"resource-type": "File", "resource-id": "/etc/shadow", "property": "mode",
+     "successful": false, "err": "stat /etc/shadow: permission denied", "summary-line": "File: /etc/shadow: mode: Error"},
+    {"resource-type": "Package", "resource-id": "telnet", "property": "installed", "meta": "not a map",
+     "skipped": true, "successful": true, "summary-line": "Package: telnet: installed: skipped"}
+  ],
+  "summary": {"failed-count": 2, "test-count": 4, "total-duration": 1500000000}
+}`
+
+func TestParseGossResults(t *testing.T) {
+	output, err := ParseGossResults([]byte(gossResults), "base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output.Statistics.Duration != 1.5 {
+		t.Errorf("duration = %v, want 1.5", output.Statistics.Duration)
+	}
+	if len(output.Controls) != 4 {
+		t.Fatalf("got %d controls, want 4", len(output.Controls))
+	}
+	for i, want := range []InspecControl{
+		{
+			ID: "Service sshd", ProfileID: "base", Status: "passed", CodeDesc: "Service sshd running",
+			Resource: "Service", Title: "sshd runs", Tags: map[string]interface{}{"severity": "high", "owner": "ops"},
+		},
+		{
+			ID: "Port tcp:23", ProfileID: "base", Status: "failed", CodeDesc: "Port tcp:23 listening", Resource: "Port",
+			Message: "Port: tcp:23: listening:\nExpected\n    <bool>: true\nto equal\n    <bool>: false",
+		},
+		{
+			ID: "File /etc/shadow", ProfileID: "base", Status: "failed", CodeDesc: "File /etc/shadow mode", Resource: "File",
+			Message: "File: /etc/shadow: mode: Error\nstat /etc/shadow: permission denied",
+		},
+		{
+			ID: "Package telnet", ProfileID: "base", Status: "skipped", CodeDesc: "Package telnet installed", Resource: "Package",
+			SkipMessage: "Package: telnet: installed: skipped",
+		},
+	} {
+		if control := output.Controls[i]; !reflect.DeepEqual(control, want) {
+			t.Errorf("control %d = %+v, want %+v", i, control, want)
+		}
+	}
+}
+
+func TestParseGossResultsErrors(t *testing.T) {
+	for _, data := range []string{"", "goss: command not found", `{"results": {}}`} {
+		if _, err := ParseGossResults([]byte(data), "base"); err == nil {
+			t.Errorf("ParseGossResults(%q) succeeded", data)
+		}
+	}
+}
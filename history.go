@@ -0,0 +1,254 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+	"github.com/spf13/viper"
+)
+
+// ControlChange is a control whose status differs between two scans.
+type ControlChange struct {
+	Profile string `json:"profile"`
+	Control string `json:"control"`
+	Before  string `json:"before"`
+	After   string `json:"after"`
+}
+
+// ScanDiff is the difference between two consecutive scans of a target with a module.
+type ScanDiff struct {
+	Target      string          `json:"target"`
+	Module      string          `json:"module"`
+	From        time.Time       `json:"from"`
+	To          time.Time       `json:"to"`
+	Regressions []ControlChange `json:"regressions"`
+	Fixes       []ControlChange `json:"fixes"`
+	Changes     []ControlChange `json:"changes"`
+}
+
+// controlKey identifies a control, whose ID is only unique within its profile.
+func controlKey(profile string, id string) string {
+	return profile + "\x00" + id
+}
+
+// splitControlKey returns the profile and ID of a control key.
+func splitControlKey(key string) (string, string) {
+	parts := strings.SplitN(key, "\x00", 2)
+	if len(parts) < 2 {
+		return "", key
+	}
+	return parts[0], parts[1]
+}
+
+// controlStatuses collapses the results of each control by control key: a
+// control failed if any of its results failed, is skipped if all were skipped
+// and passed otherwise.
+func controlStatuses(output InspecOutput) map[string]string {
+	statuses := map[string]string{}
+	for _, check := range output.Controls {
+		key := controlKey(check.ProfileID, check.ID)
+		switch {
+		case check.Status == "failed":
+			statuses[key] = "failed"
+		case check.Status == "passed" && statuses[key] != "failed":
+			statuses[key] = "passed"
+		case statuses[key] == "":
+			statuses[key] = check.Status
+		}
+	}
+	return statuses
+}
+
+// diffScans compares the control statuses of two scans. Controls missing in
+// one of the scans are reported as changes with an empty status.
+func diffScans(before InspecOutput, after InspecOutput) ScanDiff {
+	diff := ScanDiff{
+		Regressions: []ControlChange{},
+		Fixes:       []ControlChange{},
+		Changes:     []ControlChange{},
+	}
+	beforeStatuses := controlStatuses(before)
+	afterStatuses := controlStatuses(after)
+	controls := []string{}
+	for control := range beforeStatuses {
+		controls = append(controls, control)
+	}
+	for control := range afterStatuses {
+		if _, ok := beforeStatuses[control]; !ok {
+			controls = append(controls, control)
+		}
+	}
+	sort.Strings(controls)
+
+	for _, control := range controls {
+		change := ControlChange{Before: beforeStatuses[control], After: afterStatuses[control]}
+		change.Profile, change.Control = splitControlKey(control)
+		if change.Before == change.After {
+			continue
+		}
+		diff.Changes = append(diff.Changes, change)
+		if change.Before == "passed" && change.After == "failed" {
+			diff.Regressions = append(diff.Regressions, change)
+		}
+		if change.Before == "failed" && change.After == "passed" {
+			diff.Fixes = append(diff.Fixes, change)
+		}
+	}
+	return diff
+}
+
+// successfulOutputs returns the parsed reports of the records which did not fail.
+func successfulOutputs(records []*ScanRecord) ([]*ScanRecord, []InspecOutput) {
+	successful := []*ScanRecord{}
+	outputs := []InspecOutput{}
+	for _, record := range records {
+		result, err := record.Result()
+		if err != nil {
+			continue
+		}
+		successful = append(successful, record)
+		outputs = append(outputs, result.Output)
+	}
+	return successful, outputs
+}
+
+// latestDiff compares the two latest successful scans of the target and
+// module. It returns nil if there are less than two.
+func latestDiff(target string, module string) (*ScanDiff, error) {
+	history, err := resultStore.History(target, module, 0)
+	if err != nil {
+		return nil, err
+	}
+	records, outputs := successfulOutputs(history)
+	if len(records) < 2 {
+		return nil, nil
+	}
+	diff := diffScans(outputs[1], outputs[0])
+	diff.Target = target
+	diff.Module = module
+	diff.From = records[1].Start
+	diff.To = records[0].Start
+	return &diff, nil
+}
+
+// lastChanged returns for every control of the newest successful scan of the
+// target and module the start of the scan since which it has its current
+// status. The stored history is only read back to the last change of every
+// control.
+func lastChanged(target string, module string) (map[string]time.Time, error) {
+	changed := map[string]time.Time{}
+	var current map[string]string
+	unchanged := map[string]bool{}
+	err := resultStore.Walk(target, module, func(record *ScanRecord) bool {
+		result, err := record.Result()
+		if err != nil {
+			return true
+		}
+		statuses := controlStatuses(result.Output)
+		if current == nil {
+			current = statuses
+			for control := range current {
+				unchanged[control] = true
+			}
+		}
+		for control := range unchanged {
+			if statuses[control] != current[control] {
+				delete(unchanged, control)
+				continue
+			}
+			changed[control] = record.Start
+		}
+		return len(unchanged) > 0
+	})
+	return changed, err
+}
+
+// flapWindow returns flapping.window (DEFAULT: 24h).
+func flapWindow() time.Duration {
+	if viper.IsSet("flapping.window") {
+		return viper.GetDuration("flapping.window")
+	}
+	return 24 * time.Hour
+}
+
+// flapState counts the status transitions of every control of the newest
+// record within flapping.window (DEFAULT: 24h) and returns them along with the
+// controls reaching flapping.threshold (DEFAULT: 3). Records are newest first.
+func flapState(records []*ScanRecord, outputs []InspecOutput) (map[string]int, map[string]bool) {
+	flaps := map[string]int{}
+	flapping := map[string]bool{}
+	if len(records) == 0 {
+		return flaps, flapping
+	}
+	window := flapWindow()
+	threshold := 3
+	if viper.IsSet("flapping.threshold") {
+		threshold = viper.GetInt("flapping.threshold")
+	}
+
+	since := records[0].Start.Add(-window)
+	statuses := []map[string]string{}
+	for i := range records {
+		if records[i].Start.Before(since) {
+			break
+		}
+		statuses = append(statuses, controlStatuses(outputs[i]))
+	}
+	if len(statuses) == 0 {
+		return flaps, flapping
+	}
+	for control := range statuses[0] {
+		flaps[control] = 0
+		for i := 1; i < len(statuses); i++ {
+			if statuses[i][control] != statuses[i-1][control] {
+				flaps[control]++
+			}
+		}
+		flapping[control] = flaps[control] >= threshold
+	}
+	return flaps, flapping
+}
+
+// collectHistory exports the metrics derived from the stored history of the
+// target and module. Records are newest first.
+func (c collector) collectHistory(ch chan<- prometheus.Metric, records []*ScanRecord, outputs []InspecOutput, flaps map[string]int, flapping map[string]bool) {
+	diff := ScanDiff{}
+	if len(records) > 1 {
+		diff = diffScans(outputs[1], outputs[0])
+	}
+	ch <- prometheus.MustNewConstMetric(
+		prometheus.NewDesc("inspec_control_regressions", "Number of controls which changed from passed to failed since the previous scan.", []string{"target", "module"}, nil),
+		prometheus.GaugeValue,
+		float64(len(diff.Regressions)),
+		c.target, c.module.name)
+	ch <- prometheus.MustNewConstMetric(
+		prometheus.NewDesc("inspec_control_fixes", "Number of controls which changed from failed to passed since the previous scan.", []string{"target", "module"}, nil),
+		prometheus.GaugeValue,
+		float64(len(diff.Fixes)),
+		c.target, c.module.name)
+
+	lastChangedDesc := prometheus.NewDesc("inspec_control_last_changed_timestamp_seconds", "Unix time of the scan since which the control has its current status.", []string{"target", "module", "profile", "control"}, nil)
+	lastChanges, err := lastChanged(c.target, c.module.name)
+	if err != nil {
+		log.Errorf("Error reading history of target %s: %s", c.target, err)
+	}
+	for key, changed := range lastChanges {
+		profile, control := splitControlKey(key)
+		ch <- prometheus.MustNewConstMetric(lastChangedDesc, prometheus.GaugeValue, float64(changed.Unix()), c.target, c.module.name, profile, control)
+	}
+
+	flapsDesc := prometheus.NewDesc("inspec_control_flaps", "Number of status transitions of the control within the flapping window.", []string{"target", "module", "profile", "control"}, nil)
+	flappingDesc := prometheus.NewDesc("inspec_control_flapping", "Whether the control reached the flapping threshold within the flapping window.", []string{"target", "module", "profile", "control"}, nil)
+	for key, count := range flaps {
+		profile, control := splitControlKey(key)
+		ch <- prometheus.MustNewConstMetric(flapsDesc, prometheus.GaugeValue, float64(count), c.target, c.module.name, profile, control)
+		isFlapping := float64(0)
+		if flapping[key] {
+			isFlapping = 1
+		}
+		ch <- prometheus.MustNewConstMetric(flappingDesc, prometheus.GaugeValue, isFlapping, c.target, c.module.name, profile, control)
+	}
+}
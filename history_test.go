@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+)
+
+// sharedControls has the control c1 in two profiles, as with include_controls.
+const sharedControls = `{"controls": [
+  {"id": "c1", "profile_id": "p1", "status": "passed", "code_desc": "p1 passes"},
+  {"id": "c1", "profile_id": "p2", "status": "failed", "code_desc": "p2 fails"},
+  {"id": "c2", "profile_id": "p2", "status": "passed", "code_desc": "p2 passes"}
+]}`
+
+// parseOutput parses a json-min report.
+func parseOutput(t *testing.T, report string) InspecOutput {
+	var output InspecOutput
+	if err := json.Unmarshal([]byte(report), &output); err != nil {
+		t.Fatal(err)
+	}
+	return output
+}
+
+func TestDiffScansSharedControlIDs(t *testing.T) {
+	after := parseOutput(t, `{"controls": [
+	  {"id": "c1", "profile_id": "p1", "status": "failed"},
+	  {"id": "c1", "profile_id": "p2", "status": "failed"},
+	  {"id": "c2", "profile_id": "p2", "status": "passed"}
+	]}`)
+	diff := diffScans(parseOutput(t, sharedControls), after)
+	if len(diff.Regressions) != 1 || diff.Regressions[0] != (ControlChange{Profile: "p1", Control: "c1", Before: "passed", After: "failed"}) {
+		t.Errorf("regressions = %v, want c1 of p1", diff.Regressions)
+	}
+	if len(diff.Changes) != 1 {
+		t.Errorf("changes = %v, want only c1 of p1", diff.Changes)
+	}
+}
+
+func TestFlapStateNegativeWindow(t *testing.T) {
+	viper.Set("flapping.window", "-1h")
+	defer viper.Reset()
+
+	records := []*ScanRecord{{Start: time.Now()}}
+	outputs := []InspecOutput{{Controls: []InspecControl{{ID: "c1", Status: "failed"}}}}
+	flaps, flapping := flapState(records, outputs)
+	if len(flaps) != 0 || len(flapping) != 0 {
+		t.Errorf("flapState = %v, %v, want no controls", flaps, flapping)
+	}
+}
+
+// useStore sets a result store in a temporary directory as the global one.
+func useStore(t *testing.T) func() {
+	root, err := ioutil.TempDir("", "inspec_exporter_history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resultStore, err = NewResultStore(root, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		resultStore = nil
+		os.RemoveAll(root)
+	}
+}
+
+// saveScan stores a scan with the statuses of the controls c1, c2, ... of
+// the profile p1.
+func saveScan(t *testing.T, start time.Time, err error, statuses ...string) {
+	controls := []string{}
+	for i, status := range statuses {
+		controls = append(controls, fmt.Sprintf(`{"id": "c%d", "profile_id": "p1", "status": "%s"}`, i+1, status))
+	}
+	result := &ScanResult{Start: start, Raw: []byte(`{"controls": [` + strings.Join(controls, ",") + `]}`)}
+	if err := resultStore.Save(newScanRecord("host", "module", result, err)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLastChangedReadsPastFlapWindow(t *testing.T) {
+	defer useStore(t)()
+	viper.Set("flapping.window", "1h")
+	defer viper.Reset()
+
+	now := time.Now()
+	saveScan(t, now.Add(-7*24*time.Hour), nil, "passed", "failed", "passed")
+	saveScan(t, now.Add(-3*24*time.Hour), nil, "passed", "failed", "failed")
+	saveScan(t, now.Add(-2*24*time.Hour), nil, "passed", "passed", "failed")
+	saveScan(t, now.Add(-24*time.Hour), errors.New("connection refused"), "failed", "failed", "failed")
+	saveScan(t, now, nil, "passed", "passed", "failed")
+
+	changed, err := lastChanged("host", "module")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for control, want := range map[string]time.Time{
+		"c1": now.Add(-7 * 24 * time.Hour),
+		"c2": now.Add(-2 * 24 * time.Hour),
+		"c3": now.Add(-3 * 24 * time.Hour),
+	} {
+		if got := changed[controlKey("p1", control)]; !got.Equal(want) {
+			t.Errorf("%s last changed %s, want %s", control, got, want)
+		}
+	}
+	if len(changed) != 3 {
+		t.Errorf("got %d controls, want 3", len(changed))
+	}
+}
+
+// flapHistory returns records an hour apart with the statuses of the control
+// c1 of the profile p1, newest first.
+func flapHistory(statuses ...string) ([]*ScanRecord, []InspecOutput) {
+	records := []*ScanRecord{}
+	outputs := []InspecOutput{}
+	now := time.Now()
+	for i, status := range statuses {
+		records = append(records, &ScanRecord{Start: now.Add(-time.Duration(i) * time.Hour)})
+		output := InspecOutput{Controls: []InspecControl{}}
+		if status != "" {
+			output.Controls = append(output.Controls, InspecControl{ID: "c1", ProfileID: "p1", Status: status})
+		}
+		outputs = append(outputs, output)
+	}
+	return records, outputs
+}
+
+func TestFlapState(t *testing.T) {
+	defer viper.Reset()
+	for _, test := range []struct {
+		statuses  []string
+		window    string
+		threshold int
+		flaps     int
+		flapping  bool
+	}{
+		{[]string{"passed"}, "24h", 3, 0, false},
+		{[]string{"passed", "passed", "passed"}, "24h", 3, 0, false},
+		{[]string{"failed", "passed", "failed"}, "24h", 3, 2, false},
+		{[]string{"failed", "passed", "failed", "passed"}, "24h", 3, 3, true},
+		{[]string{"failed", "passed", "failed", "passed"}, "24h", 4, 3, false},
+		{[]string{"failed", "skipped", "skipped", "failed"}, "24h", 2, 2, true},
+		// a scan without the control counts as a transition
+		{[]string{"failed", "", "failed"}, "24h", 2, 2, true},
+		// scans started before the window are not counted
+		{[]string{"failed", "passed", "failed", "passed"}, "90m", 3, 1, false},
+		{[]string{"failed", "passed", "failed", "passed"}, "2h", 2, 2, true},
+	} {
+		viper.Set("flapping.window", test.window)
+		viper.Set("flapping.threshold", test.threshold)
+		flaps, flapping := flapState(flapHistory(test.statuses...))
+		key := controlKey("p1", "c1")
+		if flaps[key] != test.flaps || flapping[key] != test.flapping {
+			t.Errorf("%v within %s: %d flaps, flapping %t, want %d, %t", test.statuses, test.window, flaps[key], flapping[key], test.flaps, test.flapping)
+		}
+	}
+}
+
+func TestCollectSuppressesFlappingControls(t *testing.T) {
+	defer useStore(t)()
+	defer viper.Reset()
+
+	// c1 flips on every scan, c2 fails on every scan
+	now := time.Now()
+	for i := 4; i > 0; i-- {
+		status := []string{"failed", "passed"}[i%2]
+		saveScan(t, now.Add(-time.Duration(i)*time.Hour), nil, status, "failed")
+	}
+	result := &ScanResult{Start: now, Raw: []byte(`{"controls": [
+	  {"id": "c1", "profile_id": "p1", "status": "failed", "code_desc": "c1"},
+	  {"id": "c2", "profile_id": "p1", "status": "failed", "code_desc": "c2"}
+	]}`)}
+	result.Output = parseOutput(t, string(result.Raw))
+	saveScan(t, now, nil, "failed", "failed")
+
+	for _, test := range []struct {
+		suppress  bool
+		threshold int
+		failed    float64
+	}{
+		{false, 3, 2},
+		{true, 3, 1},
+		{true, 5, 2},
+	} {
+		viper.Set("flapping.suppress", test.suppress)
+		viper.Set("flapping.threshold", test.threshold)
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(collector{target: "host", module: &Module{name: "module", prefix: "inspec_module_"}, result: result})
+		families, err := registry.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		failed := float64(-1)
+		for _, family := range families {
+			if family.GetName() == "inspec_module_total_failed" {
+				failed = family.GetMetric()[0].GetGauge().GetValue()
+			}
+		}
+		if failed != test.failed {
+			t.Errorf("suppress %t, threshold %d: total_failed = %v, want %v", test.suppress, test.threshold, failed, test.failed)
+		}
+	}
+}
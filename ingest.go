@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+)
+
+// maxReportSize limits the size of pushed reports.
+const maxReportSize = 64 << 20
+
+var ingestedReports = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "inspec_ingested_reports_total",
+		Help: "Reports received by the inspec exporter, by source and result.",
+	},
+	[]string{"source", "result"},
+)
+
+func init() {
+	prometheus.MustRegister(ingestedReports)
+}
+
+// authorized reports whether the request carries one of the bearer tokens
+// in ingest.tokens. Without tokens ingestion is disabled.
+func authorized(r *http.Request) bool {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return false
+	}
+	token := []byte(strings.TrimPrefix(header, "Bearer "))
+	for _, allowed := range viper.GetStringSlice("ingest.tokens") {
+		if allowed != "" && subtle.ConstantTimeCompare(token, []byte(allowed)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// pushedModule reports whether the module is configured to receive reports.
+func pushedModule(name string) bool {
+	return moduleExists(name) && loadModule(name).pushed
+}
+
+// ingestReport stores an inspec json or json-min report of the target and module.
+func ingestReport(target string, module string, source string, data []byte, start time.Time) error {
+	output, err := ParseInspecReport(data)
+	if err != nil {
+		return fmt.Errorf("invalid report: %s", err)
+	}
+	record := &ScanRecord{
+		Target:   target,
+		Module:   module,
+		Start:    start,
+		Duration: output.Statistics.Duration,
+		Source:   source,
+		Report:   data,
+	}
+	for _, status := range controlStatuses(output) {
+		if status == "failed" {
+			record.ExitStatus = 100
+		}
+	}
+	return resultStore.Save(record)
+}
+
+// reportsHandler accepts inspec reports pushed by hosts running inspec
+// themselves, tagged with the target and module parameters.
+func reportsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		apiError(w, http.StatusMethodNotAllowed, "only POST is allowed")
+		return
+	}
+	if resultStore == nil {
+		apiError(w, http.StatusNotFound, "no result store configured")
+		return
+	}
+	if !authorized(r) {
+		ingestedReports.WithLabelValues("push", "unauthorized").Inc()
+		apiError(w, http.StatusUnauthorized, "invalid or missing bearer token")
+		return
+	}
+	target := r.URL.Query().Get("target")
+	module := r.URL.Query().Get("module")
+	if target == "" || module == "" {
+		apiError(w, http.StatusBadRequest, "'target' and 'module' parameters are required")
+		return
+	}
+	if !pushedModule(module) {
+		ingestedReports.WithLabelValues("push", "error").Inc()
+		apiError(w, http.StatusBadRequest, fmt.Sprintf("module '%s' does not accept pushed reports", module))
+		return
+	}
+	data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxReportSize))
+	if err != nil {
+		apiError(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+	if err := ingestReport(target, module, "push", data, time.Now()); err != nil {
+		ingestedReports.WithLabelValues("push", "error").Inc()
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ingestedReports.WithLabelValues("push", "success").Inc()
+	writeJSON(w, http.StatusCreated, map[string]string{"target": target, "module": module})
+}
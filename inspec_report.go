@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+)
+
+// inspecReport is the response of the inspec json reporter.
+type inspecReport struct {
+	Profiles []struct {
+		Name     string `json:"name"`
+		Sha256   string `json:"sha256"`
+		Controls []struct {
+			ID      string                 `json:"id"`
+			Title   string                 `json:"title"`
+			Desc    string                 `json:"desc"`
+			Impact  float64                `json:"impact"`
+			Tags    map[string]interface{} `json:"tags"`
+			Results []struct {
+				Status      string `json:"status"`
+				CodeDesc    string `json:"code_desc"`
+				Message     string `json:"message"`
+				SkipMessage string `json:"skip_message"`
+				Resource    string `json:"resource"`
+			} `json:"results"`
+		} `json:"controls"`
+	} `json:"profiles"`
+}
+
+// ParseInspecReport parses the output of the inspec json or json-min
+// reporter. Reports of the json reporter are flattened to one entry per
+// result like json-min.
+func ParseInspecReport(data []byte) (InspecOutput, error) {
+	var output InspecOutput
+	var format struct {
+		Profiles json.RawMessage `json:"profiles"`
+	}
+	if err := json.Unmarshal(data, &format); err != nil {
+		return output, err
+	}
+	if err := json.Unmarshal(data, &output); err != nil {
+		return output, err
+	}
+	if format.Profiles == nil {
+		return output, nil
+	}
+
+	var report inspecReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return output, err
+	}
+	output.Controls = []InspecControl{}
+	for _, profile := range report.Profiles {
+		for _, control := range profile.Controls {
+			for _, result := range control.Results {
+				output.Controls = append(output.Controls, InspecControl{
+					ID:            control.ID,
+					ProfileID:     profile.Name,
+					ProfileSha256: profile.Sha256,
+					Status:        result.Status,
+					CodeDesc:      result.CodeDesc,
+					Message:       result.Message,
+					SkipMessage:   result.SkipMessage,
+					Resource:      result.Resource,
+					Title:         control.Title,
+					Desc:          control.Desc,
+					Impact:        control.Impact,
+					Tags:          control.Tags,
+				})
+			}
+		}
+	}
+	return output, nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+// States of a scan job.
+const (
+	JobQueued   = "queued"
+	JobRunning  = "running"
+	JobDone     = "done"
+	JobFailed   = "failed"
+	JobCanceled = "canceled"
+)
+
+// scanJobs is the global queue of asynchronous scans.
+var scanJobs *JobQueue
+
+// ScanJob is an asynchronous scan of a target with a module.
+type ScanJob struct {
+	ID       string        `json:"id"`
+	Target   string        `json:"target"`
+	Module   string        `json:"module"`
+	State    string        `json:"state"`
+	Created  time.Time     `json:"created"`
+	Started  *time.Time    `json:"started,omitempty"`
+	Finished *time.Time    `json:"finished,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Result   *InspecOutput `json:"result,omitempty"`
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// JobQueue runs scan jobs with a fixed number of workers. Finished jobs are
+// kept for the retention period.
+type JobQueue struct {
+	mutex     sync.Mutex
+	jobs      map[string]*ScanJob
+	queue     chan *ScanJob
+	retention time.Duration
+}
+
+// NewJobQueue starts the workers of a queue holding up to size waiting jobs.
+func NewJobQueue(workers int, size int, retention time.Duration) *JobQueue {
+	q := &JobQueue{
+		jobs:      map[string]*ScanJob{},
+		queue:     make(chan *ScanJob, size),
+		retention: retention,
+	}
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+	return q
+}
+
+func newJobID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// Enqueue adds a scan of the target with the module to the queue.
+func (q *JobQueue) Enqueue(target string, module string) (ScanJob, error) {
+	id, err := newJobID()
+	if err != nil {
+		return ScanJob{}, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &ScanJob{
+		ID:      id,
+		Target:  target,
+		Module:  module,
+		State:   JobQueued,
+		Created: time.Now(),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.purge()
+	select {
+	case q.queue <- job:
+	default:
+		cancel()
+		return ScanJob{}, fmt.Errorf("scan queue is full")
+	}
+	q.jobs[id] = job
+	return *job, nil
+}
+
+// purge removes finished jobs beyond the retention. The mutex must be held.
+func (q *JobQueue) purge() {
+	for id, job := range q.jobs {
+		if job.Finished != nil && time.Since(*job.Finished) > q.retention {
+			delete(q.jobs, id)
+		}
+	}
+}
+
+// Get returns a copy of the job.
+func (q *JobQueue) Get(id string) (ScanJob, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return ScanJob{}, false
+	}
+	return *job, true
+}
+
+// Cancel stops a queued or running job. It returns false if the job is unknown.
+func (q *JobQueue) Cancel(id string) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return false
+	}
+	if job.State == JobQueued {
+		now := time.Now()
+		job.State = JobCanceled
+		job.Finished = &now
+	}
+	job.cancel()
+	return true
+}
+
+func (q *JobQueue) work() {
+	for job := range q.queue {
+		q.mutex.Lock()
+		if job.State != JobQueued {
+			q.mutex.Unlock()
+			continue
+		}
+		now := time.Now()
+		job.State = JobRunning
+		job.Started = &now
+		q.mutex.Unlock()
+
+		m := loadModule(job.Module)
+		result, err := executeScan(job.ctx, job.Target, &m)
+		if resultStore != nil && result != nil && job.ctx.Err() == nil {
+			if saveErr := resultStore.Save(newScanRecord(job.Target, job.Module, result, err)); saveErr != nil {
+				log.Errorf("Error storing result of target %s: %s", job.Target, saveErr)
+			}
+		}
+
+		q.mutex.Lock()
+		finished := time.Now()
+		job.Finished = &finished
+		switch {
+		case job.ctx.Err() != nil:
+			job.State = JobCanceled
+		case err != nil:
+			job.State = JobFailed
+			job.Error = err.Error()
+		default:
+			job.State = JobDone
+			job.Result = &result.Output
+		}
+		job.cancel()
+		q.mutex.Unlock()
+	}
+}
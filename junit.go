@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     float64          `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Properties []junitProperty `xml:"properties>property"`
+	Cases      []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitMessage `xml:"failure"`
+	Skipped   *junitMessage `xml:"skipped"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// renderJUnit renders the result as JUnit XML: every profile becomes a
+// testsuite and every control a testcase, failing if any of its results
+// failed and skipped if all were skipped.
+func renderJUnit(target string, module string, result *ScanResult) ([]byte, error) {
+	suites := junitTestSuites{Name: module, Time: result.Duration.Seconds()}
+	statuses := controlStatuses(result.Output)
+
+	profiles := []string{}
+	controls := map[string][]string{}
+	checks := map[string][]InspecControl{}
+	for _, check := range result.Output.Controls {
+		if _, ok := controls[check.ProfileID]; !ok {
+			profiles = append(profiles, check.ProfileID)
+		}
+		key := controlKey(check.ProfileID, check.ID)
+		if len(checks[key]) == 0 {
+			controls[check.ProfileID] = append(controls[check.ProfileID], check.ID)
+		}
+		checks[key] = append(checks[key], check)
+	}
+	sort.Strings(profiles)
+
+	for _, profile := range profiles {
+		suite := junitTestSuite{
+			Name:      profile,
+			Timestamp: result.Start.Format("2006-01-02T15:04:05"),
+			Properties: []junitProperty{
+				{Name: "target", Value: target},
+				{Name: "module", Value: module},
+			},
+		}
+		for _, id := range controls[profile] {
+			key := controlKey(profile, id)
+			testCase := junitTestCase{Name: id, ClassName: module + "." + profile}
+			lines := []string{}
+			messages := []string{}
+			firstFailure := ""
+			for _, check := range checks[key] {
+				lines = append(lines, fmt.Sprintf("%s: %s", check.Status, check.CodeDesc))
+				if check.Status == "failed" {
+					if firstFailure == "" {
+						firstFailure = check.CodeDesc
+					}
+					messages = append(messages, check.CodeDesc+"\n"+check.Message)
+				}
+				if check.Status == "skipped" && statuses[key] == "skipped" {
+					messages = append(messages, check.SkipMessage)
+				}
+			}
+			testCase.SystemOut = strings.Join(lines, "\n")
+			switch statuses[key] {
+			case "failed":
+				testCase.Failure = &junitMessage{Message: firstFailure, Text: strings.Join(messages, "\n\n")}
+				suite.Failures++
+			case "passed":
+			default:
+				testCase.Skipped = &junitMessage{Message: strings.Join(messages, "; ")}
+				suite.Skipped++
+			}
+			suite.Tests++
+			suite.Cases = append(suite.Cases, testCase)
+		}
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Skipped += suite.Skipped
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	content, err := xml.MarshalIndent(suites, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(content, '\n')...), nil
+}
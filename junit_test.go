@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+func TestRenderJUnitSharedControlIDs(t *testing.T) {
+	content, err := renderJUnit("host", "module", &ScanResult{Output: parseOutput(t, sharedControls)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var suites junitTestSuites
+	if err := xml.Unmarshal(content, &suites); err != nil {
+		t.Fatal(err)
+	}
+	if len(suites.Suites) != 2 {
+		t.Fatalf("got %d suites, want 2", len(suites.Suites))
+	}
+	for _, test := range []struct {
+		profile  string
+		tests    int
+		failures int
+		out      string
+	}{
+		{"p1", 1, 0, "passed: p1 passes"},
+		{"p2", 2, 1, "failed: p2 fails"},
+	} {
+		var suite *junitTestSuite
+		for i := range suites.Suites {
+			if suites.Suites[i].Name == test.profile {
+				suite = &suites.Suites[i]
+			}
+		}
+		if suite == nil {
+			t.Fatalf("suite %s is missing", test.profile)
+		}
+		if suite.Tests != test.tests || suite.Failures != test.failures {
+			t.Errorf("suite %s has %d tests and %d failures, want %d and %d", test.profile, suite.Tests, suite.Failures, test.tests, test.failures)
+		}
+		if suite.Cases[0].Name != "c1" || suite.Cases[0].SystemOut != test.out {
+			t.Errorf("suite %s: case %s has output %q, want c1 with %q", test.profile, suite.Cases[0].Name, suite.Cases[0].SystemOut, test.out)
+		}
+	}
+}
@@ -8,9 +8,7 @@ import (
 
 	"gopkg.in/alecthomas/kingpin.v2"
 
-	"io/ioutil"
 	"os"
-	"os/exec"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/prometheus/client_golang/prometheus"
@@ -24,6 +22,8 @@ var (
 	configFile    = kingpin.Flag("config.file", "Filename to configuration file, without extention (DEFAULT: inspec)").Default("inspec").String()
 	listenAddress = kingpin.Flag("web.listen-address", "Address to listen on for web interface and telemetry.").Default(":9124").String()
 
+	serveCommand = kingpin.Command("serve", "Run the exporter (DEFAULT).").Default()
+
 	// Metrics about the inspec exporter itself.
 	inspecDuration = prometheus.NewSummaryVec(
 		prometheus.SummaryOpts{
@@ -49,86 +49,75 @@ func init() {
 func handler(w http.ResponseWriter, r *http.Request) {
 	target := r.URL.Query().Get("target")
 	module := r.URL.Query().Get("module")
+	cached := r.URL.Query().Get("cached") == "true"
+	var trace *probeTrace
+	if r.URL.Query().Get("debug") == "true" {
+		trace = &probeTrace{}
+	}
 
-	globalPath := viper.GetString("profile_path")
-	if _, err := os.Stat(globalPath); os.IsNotExist(err) {
-		// path/to/whatever does not exist
-		http.Error(w, "'profile_path' in config is empty or does not exists", 500)
-		inspecRequestErrors.Inc()
-		return
+	if replaySource == nil {
+		// a missing profile_path is fine as long as the config defines modules
+		if names, err := moduleNames(); err == nil && len(names) == 0 {
+			http.Error(w, "No modules configured: 'profile_path' in config is empty or does not exists", 500)
+			inspecRequestErrors.Inc()
+			return
+		}
 	}
 
 	start := time.Now()
 	registry := prometheus.NewRegistry()
 
-	m := Module{}
-	if module != "" {
-		if _, err := os.Stat(globalPath + "/" + module); os.IsNotExist(err) {
-			http.Error(w, fmt.Sprintf("Unkown module '%s'", module), 400)
+	if module == "auto" {
+		names, err := targetModules(target)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Modules of target '%s' are not readable: %s", target, err), 500)
 			inspecRequestErrors.Inc()
 			return
 		}
-
-		//TODO: use defaults
-		if viper.GetStringMap(module) == nil {
-			m = Module{
-				path:            globalPath + "/" + module,
-				needSudo:        false,
-				prefix:          "inspec_" + module + "_",
-				sshIdentityFile: "",
-				sshPort:         0,
-				sshUser:         "",
+		// the recorded modules of replay mode were selected for the platform of the target
+		var platform *Platform
+		if replaySource == nil {
+			detected, err := DetectPlatform(target)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Platform detection of target '%s' failed: %s", target, err), 500)
+				inspecRequestErrors.Inc()
+				return
 			}
-		} else {
-			m = Module{
-				path:            viper.GetString(fmt.Sprintf("%v.path", module)),
-				needSudo:        viper.GetBool(fmt.Sprintf("%v.need_sudo", module)),
-				prefix:          "inspec_" + viper.GetString(fmt.Sprintf("%v.prefix", module)) + "_",
-				sshIdentityFile: viper.GetString(fmt.Sprintf("%v.ssh_identity_file", module)),
-				sshPort:         viper.GetInt(fmt.Sprintf("%v.ssh_port", module)),
-				sshUser:         viper.GetString(fmt.Sprintf("%v.ssh_user", module)),
+			platform = &detected
+			log.Debugf("Detected platform '%s' %v on target '%s'", platform.Name, platform.Families, target)
+		}
+		for _, name := range names {
+			m := loadModule(name)
+			if platform == nil || platform.Supports(&m) {
+				registry.MustRegister(collector{target: target, module: &m, cached: cached, trace: trace})
 			}
 		}
-		collector := collector{target: target, module: &m}
-		registry.MustRegister(collector)
-	} else {
-		if _, err := os.Stat(globalPath + "/"); os.IsNotExist(err) {
-			http.Error(w, fmt.Sprintf("Profule path '%s'", module), 400)
+	} else if module != "" {
+		if !targetModuleExists(target, module) {
+			http.Error(w, fmt.Sprintf("Unkown module '%s'", module), 400)
 			inspecRequestErrors.Inc()
 			return
 		}
-		profiles, err := ioutil.ReadDir(globalPath + "/")
+		m := loadModule(module)
+		registry.MustRegister(collector{target: target, module: &m, cached: cached, trace: trace})
+	} else {
+		names, err := targetModules(target)
 		if err != nil {
-			http.Error(w, "'profile_path' is not readable", 500)
+			http.Error(w, fmt.Sprintf("Modules of target '%s' are not readable: %s", target, err), 500)
 			inspecRequestErrors.Inc()
 			return
 		}
-		for _, profile := range profiles {
-			//TODO: use defaults
-			if viper.GetStringMap(profile.Name()) == nil {
-				m = Module{
-					path:            globalPath + "/" + profile.Name(),
-					needSudo:        false,
-					prefix:          "inspec_" + profile.Name() + "_",
-					sshIdentityFile: "",
-					sshPort:         0,
-					sshUser:         "",
-				}
-			} else {
-				m = Module{
-					path:            viper.GetString(fmt.Sprintf("%v.path", profile.Name())),
-					needSudo:        viper.GetBool(fmt.Sprintf("%v.need_sudo", profile.Name())),
-					prefix:          "inspec_" + viper.GetString(fmt.Sprintf("%v.prefix", profile.Name())) + "_",
-					sshIdentityFile: viper.GetString(fmt.Sprintf("%v.ssh_identity_file", profile.Name())),
-					sshPort:         viper.GetInt(fmt.Sprintf("%v.ssh_port", profile.Name())),
-					sshUser:         viper.GetString(fmt.Sprintf("%v.ssh_user", profile.Name())),
-				}
-			}
-			collector := collector{target: target, module: &m}
-			registry.Register(collector)
+		for _, name := range names {
+			m := loadModule(name)
+			registry.MustRegister(collector{target: target, module: &m, cached: cached, trace: trace})
 		}
 	}
 
+	if trace != nil {
+		trace.write(w, target, module, registry)
+		return
+	}
+
 	// Delegate http serving to Promethues client library, which will call collector.Collect.
 	h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
 	h.ServeHTTP(w, r)
@@ -137,26 +126,132 @@ func handler(w http.ResponseWriter, r *http.Request) {
 	log.Debugf("Scrape of target '%s' with module '%s' took %f seconds", target, module, duration)
 }
 
+// readConfig finds and reads the config file.
+func readConfig() error {
+	viper.SetDefault("oscap_path", "oscap")
+	viper.SetDefault("oscap_ssh_path", "oscap-ssh")
+	viper.SetDefault("goss_path", "goss")
+	viper.SetDefault("bundle_path", "bundle")
+	viper.SetDefault("git_path", "git")
+	viper.AddConfigPath(".")
+	viper.SetConfigName(*configFile)              // name of config file (without extension)
+	viper.AddConfigPath("/etc/inspec_exporter/")  // path to look for the config file in
+	viper.AddConfigPath("$HOME/.inspec_exporter") // call multiple times to add many search paths
+	return viper.ReadInConfig()                   // Find and read the config file
+}
+
+// loadConfig reads the config file and opens the result store.
+func loadConfig() error {
+	err := readConfig()
+	if err != nil { // Handle errors reading the config file
+		return fmt.Errorf("reading config file: %s", err)
+	}
+	startReplay()
+	if viper.IsSet("store.path") {
+		maxCount := 100
+		if viper.IsSet("store.max_count") {
+			maxCount = viper.GetInt("store.max_count")
+		}
+		resultStore, err = NewResultStore(viper.GetString("store.path"), viper.GetDuration("store.max_age"), maxCount)
+		if err != nil {
+			return fmt.Errorf("opening result store: %s", err)
+		}
+		log.Infof("Storing results in %s", viper.GetString("store.path"))
+	}
+	return nil
+}
+
+// verifyModules checks that the given modules, or all modules if there are
+// none, can be run. Unknown modules are left to the command to report.
+func verifyModules(names []string) error {
+	if viper.IsSet("replay.directory") {
+		return nil
+	}
+	if len(names) == 0 {
+		var err error
+		if names, err = moduleNames(); err != nil {
+			// requests for the modules report the error
+			log.Errorf("Error listing modules: %s", err)
+		}
+	}
+	for _, name := range names {
+		if !moduleExists(name) {
+			continue
+		}
+		m := loadModule(name)
+		if err := verifyModule(&m); err != nil {
+			return fmt.Errorf("module %s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// mustLoadConfig loads the config, verifies the modules if verify is set and
+// exits on errors.
+func mustLoadConfig(verify bool, modules ...string) {
+	if err := loadConfig(); err != nil {
+		log.Fatalf("Error loading config: %s", err)
+	}
+	if !verify {
+		return
+	}
+	if err := verifyModules(modules); err != nil {
+		log.Fatalf("Error loading config: %s", err)
+	}
+}
+
 func main() {
 	log.AddFlags(kingpin.CommandLine)
 	kingpin.Version(version.Print("inspec_exporter"))
 	kingpin.HelpFlag.Short('h')
-	kingpin.Parse()
+	command := kingpin.Parse()
+
+	switch command {
+	case checkConfigCommand.FullCommand():
+		os.Exit(runCheckConfig())
+	case convertCommand.FullCommand():
+		os.Exit(runConvert())
+	case scanCommand.FullCommand():
+		mustLoadConfig(true, *scanModule)
+		os.Exit(runScan())
+	case exportCommand.FullCommand():
+		// stored results need no scanner
+		mustLoadConfig(*exportFresh, *exportModule)
+		os.Exit(runExport())
+	case pushCommand.FullCommand():
+		mustLoadConfig(true, *pushModules...)
+		os.Exit(runPush())
+	case textfileCommand.FullCommand():
+		mustLoadConfig(true, *textfileModules...)
+		os.Exit(runTextfile())
+	}
 
 	log.Infoln("Starting inspec exporter", version.Info())
 	log.Infoln("Build context", version.BuildContext())
+	mustLoadConfig(true)
+	serve()
+}
 
-	viper.AddConfigPath(".")
-	viper.SetConfigName(*configFile)              // name of config file (without extension)
-	viper.AddConfigPath("/etc/inspec_exporter/")  // path to look for the config file in
-	viper.AddConfigPath("$HOME/.inspec_exporter") // call multiple times to add many search paths
-	err := viper.ReadInConfig()                   // Find and read the config file
-	if err != nil {                               // Handle errors reading the config file
-		panic(fmt.Errorf("fatal error config file: %s", err))
+// serve runs the exporter.
+func serve() {
+	workers, queueSize, retention := 2, 100, time.Hour
+	if viper.IsSet("jobs.workers") {
+		workers = viper.GetInt("jobs.workers")
+	}
+	if viper.IsSet("jobs.queue_size") {
+		queueSize = viper.GetInt("jobs.queue_size")
+	}
+	if viper.IsSet("jobs.retention") {
+		retention = viper.GetDuration("jobs.retention")
+	}
+	scanJobs = NewJobQueue(workers, queueSize, retention)
+	// replay mode runs no scanners
+	if replaySource == nil {
+		checkBundles()
+		go syncGitLoop()
 	}
-	_, inspecLookErr := exec.LookPath(viper.GetString("inspec_path"))
-	if inspecLookErr != nil {
-		panic(inspecLookErr)
+	if err := startSpool(); err != nil {
+		log.Fatalf("Error starting spool: %s", err)
 	}
 	viper.WatchConfig()
 	viper.OnConfigChange(func(e fsnotify.Event) {
@@ -164,6 +259,17 @@ func main() {
 	})
 
 	http.HandleFunc("/metrics", handler)
+	http.Handle("/exporter-metrics", promhttp.Handler())
+	http.HandleFunc("/report", reportHandler)
+	http.HandleFunc("/matrix", matrixHandler)
+	http.HandleFunc("/api/v1/diff", diffHandler)
+	http.HandleFunc("/api/v1/results", resultsHandler)
+	http.HandleFunc("/api/v1/results/", exportHandler)
+	http.HandleFunc("/api/v1/targets", targetsHandler)
+	http.HandleFunc("/api/v1/modules", modulesHandler)
+	http.HandleFunc("/api/v1/scans", scansHandler)
+	http.HandleFunc("/api/v1/reports", reportsHandler)
+	http.HandleFunc("/api/v1/scans/", scanHandler)
 
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(`<html>
@@ -189,7 +295,15 @@ func main() {
             		<label>Module:</label> <input type="text" name="module" placeholder="module" value="linux-baseline"><br>
             		<input type="submit" value="Submit">
             	</form>
+            	<h2>Report</h2>
+            	<form action="/report">
+            		<label>Target:</label> <input type="text" name="target" placeholder="X.X.X.X" value=""><br>
+            		<label>Module:</label> <input type="text" name="module" placeholder="module" value="linux-baseline"><br>
+            		<input type="submit" value="Show">
+            	</form>
+				<p><a href="/matrix">Compliance Matrix</a></p>
 				<p><a href="/metrics">Metrics</a></p>
+				<p><a href="/exporter-metrics">Exporter Metrics</a></p>
             </body>
             </html>`))
 	})
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+// matrixCell is the latest scan of a target with a module.
+type matrixCell struct {
+	Module string
+	Found  bool
+	Ratio  float64
+	Age    time.Duration
+	Error  string
+	Failed int
+}
+
+// Class returns the CSS class of the cell.
+func (c matrixCell) Class() string {
+	switch {
+	case !c.Found:
+		return ""
+	case c.Error != "":
+		return "error"
+	case c.Failed > 0:
+		return "failed"
+	}
+	return "passed"
+}
+
+// matrixRow holds the cells of a target, one per module.
+type matrixRow struct {
+	Target string
+	Cells  []matrixCell
+	// worstRatio and oldest are used for sorting.
+	worstRatio float64
+	oldest     time.Duration
+}
+
+// matrixPage is the data of the matrix template.
+type matrixPage struct {
+	Modules []string
+	Rows    []matrixRow
+	Sort    string
+}
+
+// newMatrixPage builds the grid of all stored targets and modules.
+func newMatrixPage(sortBy string) (matrixPage, error) {
+	page := matrixPage{Sort: sortBy}
+	targets, err := resultStore.Targets()
+	if err != nil {
+		return page, err
+	}
+	for _, target := range targets {
+		modules, err := resultStore.Modules(target)
+		if err != nil {
+			return page, err
+		}
+		for _, module := range modules {
+			if !include(page.Modules, module) {
+				page.Modules = append(page.Modules, module)
+			}
+		}
+	}
+	sort.Strings(page.Modules)
+
+	for _, target := range targets {
+		row := matrixRow{Target: target, worstRatio: 101}
+		for _, module := range page.Modules {
+			cell := matrixCell{Module: module}
+			record, err := resultStore.Latest(target, module)
+			if err != nil {
+				return page, err
+			}
+			if record != nil {
+				cell.Found = true
+				cell.Age = time.Since(record.Start).Round(time.Second)
+				cell.Error = record.Error
+				if result, err := record.Result(); err != nil {
+					cell.Error = err.Error()
+				} else {
+					passed := 0
+					for _, status := range controlStatuses(result.Output) {
+						switch status {
+						case "passed":
+							passed++
+						case "failed":
+							cell.Failed++
+						}
+					}
+					if passed+cell.Failed > 0 {
+						cell.Ratio = 100 * float64(passed) / float64(passed+cell.Failed)
+					}
+				}
+				if cell.Ratio < row.worstRatio {
+					row.worstRatio = cell.Ratio
+				}
+				if cell.Age > row.oldest {
+					row.oldest = cell.Age
+				}
+			}
+			row.Cells = append(row.Cells, cell)
+		}
+		page.Rows = append(page.Rows, row)
+	}
+
+	sort.SliceStable(page.Rows, func(i, j int) bool {
+		switch sortBy {
+		case "ratio":
+			return page.Rows[i].worstRatio < page.Rows[j].worstRatio
+		case "age":
+			return page.Rows[i].oldest > page.Rows[j].oldest
+		}
+		return page.Rows[i].Target < page.Rows[j].Target
+	})
+	return page, nil
+}
+
+var matrixTemplate = template.Must(template.New("matrix").Parse(matrixHTML))
+
+// matrixHandler renders the compliance matrix of all stored targets and
+// modules, sorted by target, worst pass ratio or oldest scan.
+func matrixHandler(w http.ResponseWriter, r *http.Request) {
+	if resultStore == nil {
+		http.Error(w, "no result store configured", http.StatusNotFound)
+		inspecRequestErrors.Inc()
+		return
+	}
+	page, err := newMatrixPage(r.URL.Query().Get("sort"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		inspecRequestErrors.Inc()
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := matrixTemplate.Execute(w, page); err != nil {
+		log.Errorf("Error rendering matrix: %s", err)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// reservedKeys are top level config keys which are not module sections.
+var reservedKeys = map[string]bool{
+	"inspec_path":    true,
+	"profile_path":   true,
+	"oscap_path":     true,
+	"oscap_ssh_path": true,
+	"goss_path":      true,
+	"auto":           true,
+	"store":          true,
+	"flapping":       true,
+	"jobs":           true,
+	"ingest":         true,
+	"spool":          true,
+	"replay":         true,
+	"env":            true,
+	"chef_license":   true,
+	"isolate_home":   true,
+	"bundle_path":    true,
+	"git":            true,
+	"git_path":       true,
+}
+
+// chefLicenses are the accepted values of CHEF_LICENSE.
+var chefLicenses = map[string]bool{
+	"accept":            true,
+	"accept-silent":     true,
+	"accept-no-persist": true,
+}
+
+// loadModule builds the Module config for the given name. Values which are
+// not set in the module section of the config fall back to defaults derived
+// from the profile path.
+func loadModule(name string) Module {
+	key := func(k string) string {
+		return fmt.Sprintf("%v.%v", name, k)
+	}
+	m := Module{
+		name:            name,
+		path:            filepath.Join(viper.GetString("profile_path"), name),
+		prefix:          "inspec_" + normalize(name) + "_",
+		needSudo:        viper.GetBool(key("need_sudo")),
+		sshIdentityFile: viper.GetString(key("ssh_identity_file")),
+		sshPort:         viper.GetInt(key("ssh_port")),
+		sshUser:         viper.GetString(key("ssh_user")),
+		platforms:       viper.GetStringSlice(key("platforms")),
+		scanner:         "inspec",
+		oscapProfile:    viper.GetString(key("oscap_profile")),
+		resultsFile:     viper.GetString(key("results_file")),
+		inspecPath:      viper.GetString("inspec_path"),
+		env:             viper.GetStringSlice("env"),
+		workDir:         viper.GetString(key("working_dir")),
+		gemfile:         viper.GetString(key("gemfile")),
+		bundlePath:      viper.GetString("bundle_path"),
+		gitRepo:         viper.GetString(key("git_repo")),
+		gitRef:          "HEAD",
+		wrapper:         viper.GetStringSlice(key("wrapper")),
+		pushed:          viper.GetString(key("source")) == "push",
+		maxAge:          24 * time.Hour,
+	}
+	if viper.IsSet("ingest.max_age") {
+		m.maxAge = viper.GetDuration("ingest.max_age")
+	}
+	if viper.IsSet(key("max_age")) {
+		m.maxAge = viper.GetDuration(key("max_age"))
+	}
+	if viper.IsSet(key("path")) {
+		m.path = viper.GetString(key("path"))
+	}
+	if viper.IsSet(key("inspec_path")) {
+		m.inspecPath = viper.GetString(key("inspec_path"))
+	}
+	license := viper.GetString("chef_license")
+	if viper.IsSet(key("chef_license")) {
+		license = viper.GetString(key("chef_license"))
+	}
+	if license != "" {
+		m.env = append(m.env, "CHEF_LICENSE="+license)
+	}
+	// variables of the module override the global ones
+	m.env = append(m.env, viper.GetStringSlice(key("env"))...)
+	m.isolateHome = viper.GetBool("isolate_home")
+	if viper.IsSet(key("isolate_home")) {
+		m.isolateHome = viper.GetBool(key("isolate_home"))
+	}
+	if m.gemfile != "" {
+		m.env = append(m.env, "BUNDLE_GEMFILE="+m.gemfile)
+		// the inspec of the bundle, unless the module names one
+		if !viper.IsSet(key("inspec_path")) {
+			m.inspecPath = "inspec"
+		}
+	}
+	if m.gitRepo != "" {
+		if viper.IsSet(key("git_ref")) {
+			m.gitRef = viper.GetString(key("git_ref"))
+		}
+		// path is relative to the checkout of git-backed modules
+		checkout := currentCheckout(name)
+		m.gitCommit = checkout.commit
+		m.path = filepath.Join(checkout.dir, viper.GetString(key("path")))
+	}
+	if viper.IsSet(key("scanner")) {
+		m.scanner = viper.GetString(key("scanner"))
+	}
+	if viper.IsSet(key("prefix")) {
+		m.prefix = "inspec_" + viper.GetString(key("prefix")) + "_"
+	}
+	return m
+}
+
+// verifyModule checks the environment of the module and that its executable
+// and working directory exist.
+func verifyModule(m *Module) error {
+	for _, env := range m.env {
+		if strings.HasPrefix(env, "CHEF_LICENSE=") && !chefLicenses[strings.TrimPrefix(env, "CHEF_LICENSE=")] {
+			return fmt.Errorf("invalid chef license '%s'", strings.TrimPrefix(env, "CHEF_LICENSE="))
+		}
+		if !strings.Contains(env, "=") {
+			return fmt.Errorf("env: '%s' is not KEY=value", env)
+		}
+	}
+	if m.workDir != "" {
+		if err := checkDir(m.workDir); err != nil {
+			return fmt.Errorf("working_dir: %s", err)
+		}
+	}
+	if m.gitRepo != "" {
+		if _, err := exec.LookPath(viper.GetString("git_path")); err != nil {
+			return fmt.Errorf("git_path: %s", err)
+		}
+	}
+	if m.pushed || m.scanner != "inspec" {
+		return nil
+	}
+	if m.gemfile != "" {
+		if err := checkFile(m.gemfile, false); err != nil {
+			return fmt.Errorf("gemfile: %s", err)
+		}
+		if _, err := exec.LookPath(m.bundlePath); err != nil {
+			return fmt.Errorf("bundle_path: %s", err)
+		}
+		// inspec is installed by the bundle
+		return nil
+	}
+	if _, err := exec.LookPath(m.inspecPath); err != nil {
+		return fmt.Errorf("inspec_path: %s", err)
+	}
+	return nil
+}
+
+// moduleExists reports whether the module has a profile in profile_path or a
+// section in the config.
+func moduleExists(name string) bool {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return false
+	}
+	if _, err := os.Stat(filepath.Join(viper.GetString("profile_path"), name)); err == nil {
+		return true
+	}
+	return !reservedKeys[name] && viper.IsSet(name)
+}
+
+// moduleNames returns all known modules, which are the profiles found in
+// profile_path plus the module sections of the config. A missing profile_path
+// holds no profiles.
+func moduleNames() ([]string, error) {
+	names := []string{}
+	profiles, err := ioutil.ReadDir(viper.GetString("profile_path"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, profile := range profiles {
+		if profile.IsDir() {
+			names = append(names, profile.Name())
+		}
+	}
+	for _, key := range viper.AllKeys() {
+		parts := strings.SplitN(key, ".", 2)
+		if len(parts) < 2 || reservedKeys[parts[0]] || include(names, parts[0]) {
+			continue
+		}
+		names = append(names, parts[0])
+	}
+	return names, nil
+}
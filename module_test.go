@@ -0,0 +1,25 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestModuleNamesWithoutProfilePath(t *testing.T) {
+	viper.Set("profile_path", "/nonexistent/inspec_exporter/profiles")
+	viper.Set("baseline.scanner", "goss")
+	defer viper.Reset()
+
+	names, err := moduleNames()
+	if err != nil {
+		t.Fatalf("moduleNames: %s", err)
+	}
+	if !reflect.DeepEqual(names, []string{"baseline"}) {
+		t.Errorf("got modules %v, want [baseline]", names)
+	}
+	if !moduleExists("baseline") || moduleExists("missing") {
+		t.Errorf("moduleExists does not match the config sections")
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/log"
+	"github.com/spf13/viper"
+)
+
+// xccdfRule is the definition of a rule in the benchmark.
+type xccdfRule struct {
+	ID          string `xml:"id,attr"`
+	Severity    string `xml:"severity,attr"`
+	Title       string `xml:"title"`
+	Description string `xml:"description"`
+}
+
+// xccdfRuleResult is the result of a rule in a TestResult.
+type xccdfRuleResult struct {
+	IDRef    string   `xml:"idref,attr"`
+	Severity string   `xml:"severity,attr"`
+	Result   string   `xml:"result"`
+	Messages []string `xml:"message"`
+}
+
+// xccdfStatuses maps XCCDF results to inspec statuses. Rules which are not
+// selected by the profile are left out.
+var xccdfStatuses = map[string]string{
+	"pass":          "passed",
+	"fixed":         "passed",
+	"fail":          "failed",
+	"error":         "failed",
+	"unknown":       "failed",
+	"notapplicable": "skipped",
+	"notchecked":    "skipped",
+	"informational": "skipped",
+}
+
+// xccdfImpacts maps XCCDF severities to inspec impacts.
+var xccdfImpacts = map[string]float64{
+	"high":   0.7,
+	"medium": 0.5,
+	"low":    0.3,
+}
+
+// ParseXCCDFResults maps the rule results of an XCCDF results or ARF
+// document to the control model of inspec.
+func ParseXCCDFResults(data []byte) (InspecOutput, error) {
+	var output InspecOutput
+	output.Controls = []InspecControl{}
+	rules := map[string]xccdfRule{}
+	results := []xccdfRuleResult{}
+	benchmark := ""
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return output, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "Benchmark":
+			for _, attr := range start.Attr {
+				if attr.Name.Local == "id" && benchmark == "" {
+					benchmark = attr.Value
+				}
+			}
+		case "Rule":
+			var rule xccdfRule
+			if err := decoder.DecodeElement(&rule, &start); err != nil {
+				return output, err
+			}
+			rules[rule.ID] = rule
+		case "rule-result":
+			var result xccdfRuleResult
+			if err := decoder.DecodeElement(&result, &start); err != nil {
+				return output, err
+			}
+			results = append(results, result)
+		}
+	}
+	if len(results) == 0 {
+		return output, fmt.Errorf("no XCCDF rule results found")
+	}
+
+	for _, result := range results {
+		status, ok := xccdfStatuses[result.Result]
+		if !ok {
+			continue
+		}
+		rule := rules[result.IDRef]
+		severity := result.Severity
+		if severity == "" {
+			severity = rule.Severity
+		}
+		control := InspecControl{
+			ID:        result.IDRef,
+			ProfileID: benchmark,
+			Status:    status,
+			CodeDesc:  strings.TrimSpace(rule.Title),
+			Title:     strings.TrimSpace(rule.Title),
+			Desc:      strings.TrimSpace(rule.Description),
+			Impact:    xccdfImpacts[severity],
+			Tags:      map[string]interface{}{"severity": severity, "result": result.Result},
+		}
+		if control.CodeDesc == "" {
+			control.CodeDesc = result.IDRef
+		}
+		message := strings.TrimSpace(strings.Join(result.Messages, "\n"))
+		if status == "skipped" {
+			control.SkipMessage = result.Result
+		} else if status == "failed" {
+			control.Message = message
+			if control.Message == "" {
+				control.Message = result.Result
+			}
+		}
+		output.Controls = append(output.Controls, control)
+	}
+	return output, nil
+}
+
+// oscapArgs returns the command line of oscap, or of oscap-ssh for remote targets.
+func oscapArgs(target string, config *Module, resultsFile string) []string {
+	eval := []string{"xccdf", "eval", "--results-arf", resultsFile}
+	if config.oscapProfile != "" {
+		eval = append(eval, "--profile", config.oscapProfile)
+	}
+	eval = append(eval, config.path)
+	if target == "" {
+		return append([]string{viper.GetString("oscap_path")}, eval...)
+	}
+	args := []string{viper.GetString("oscap_ssh_path")}
+	if config.needSudo {
+		args = append(args, "--sudo")
+	}
+	port := config.sshPort
+	if port == 0 {
+		port = 22
+	}
+	args = append(args, fmt.Sprintf("%v@%v", config.sshUser, target), strconv.Itoa(port))
+	return append(args, eval...)
+}
+
+// oscapEnv returns the environment of oscap-ssh, which has no option for the
+// identity file.
+func oscapEnv(target string, config *Module) []string {
+	if target == "" || config.sshIdentityFile == "" {
+		return nil
+	}
+	return []string{"SSH_ADDITIONAL_OPTIONS=-i " + config.sshIdentityFile}
+}
+
+// RunOscap evaluates the XCCDF benchmark or SCAP data stream in the path of
+// the module with OpenSCAP, or reads the results_file of the module.
+func RunOscap(ctx context.Context, target string, config *Module) (*ScanResult, error) {
+	result := &ScanResult{Start: time.Now()}
+	resultsFile := config.resultsFile
+	if resultsFile == "" {
+		tmp, err := ioutil.TempFile("", "inspec_exporter_arf")
+		if err != nil {
+			return nil, err
+		}
+		tmp.Close()
+		defer os.Remove(tmp.Name())
+		resultsFile = tmp.Name()
+
+		args := oscapArgs(target, config, resultsFile)
+		oscapCommand, cleanup, err := moduleCommand(config, args[0], args[1:]...)
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup()
+		oscapCommand.Env = append(oscapCommand.Env, oscapEnv(target, config)...)
+		log.Debugf("Running %v", redactArgs(oscapCommand.Args))
+		var stdout, stderr bytes.Buffer
+		oscapCommand.Stdout = &stdout
+		oscapCommand.Stderr = &stderr
+		result.Args = oscapCommand.Args
+		err = runCommand(ctx, oscapCommand)
+		result.Stderr = stderr.Bytes()
+		result.ExitCode = exitCode(err)
+		// oscap exits with 2 if a rule failed
+		if err != nil && result.ExitCode != 2 {
+			result.Duration = time.Since(result.Start)
+			return result, fmt.Errorf("%s: %s", err, strings.TrimSpace(stderr.String()))
+		}
+	}
+
+	data, err := ioutil.ReadFile(resultsFile)
+	result.Duration = time.Since(result.Start)
+	if err != nil {
+		return result, err
+	}
+	parseStart := time.Now()
+	result.Output, err = ParseXCCDFResults(data)
+	result.ParseDuration = time.Since(parseStart)
+	if err != nil {
+		return result, fmt.Errorf("parsing XCCDF results failed: %s", err)
+	}
+	result.Output.Statistics.Duration = result.Duration.Seconds()
+	return result, storeMappedOutput(result)
+}
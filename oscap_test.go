@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// xccdfResults returns an XCCDF results document with a rule of the given
+// severity and a result for each of the results.
+func xccdfResults(severity string, results ...string) string {
+	var rules, ruleResults strings.Builder
+	for _, result := range results {
+		fmt.Fprintf(&rules, `<Rule id="rule_%s" severity="%s"><title> %s title </title><description>%s description</description></Rule>`, result, severity, result, result)
+		fmt.Fprintf(&ruleResults, `<rule-result idref="rule_%s"><result>%s</result></rule-result>`, result, result)
+	}
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<Benchmark xmlns="http://checklists.nist.gov/xccdf/1.2" id="xccdf_benchmark">` + rules.String() + `
+<TestResult id="xccdf_testresult">` + ruleResults.String() + `</TestResult>
+</Benchmark>`
+}
+
+// arfResults wraps the benchmark and a rule result in an ARF document as
+// written by `oscap xccdf eval --results-arf`.
+const arfResults = `<?xml version="1.0" encoding="UTF-8"?>
+<arf:asset-report-collection xmlns:arf="http://scap.nist.gov/schema/asset-reporting-format/1.1">
+  <core:relationships xmlns:core="http://scap.nist.gov/schema/reporting-core/1.1"/>
+  <arf:report-requests>
+    <arf:report-request id="collection1">
+      <arf:content>
+        <ds:data-stream-collection xmlns:ds="http://scap.nist.gov/schema/scap/source/1.2">
+          <ds:component id="xccdf">
+            <Benchmark xmlns="http://checklists.nist.gov/xccdf/1.2" id="xccdf_org.ssgproject.content_benchmark_RHEL-8">
+              <Group id="xccdf_group">
+                <Rule id="xccdf_rule_sshd" severity="medium">
+                  <title>Disable SSH Root Login</title>
+                  <description>Root logins over SSH are disabled.</description>
+                </Rule>
+              </Group>
+            </Benchmark>
+          </ds:component>
+        </ds:data-stream-collection>
+      </arf:content>
+    </arf:report-request>
+  </arf:report-requests>
+  <arf:reports>
+    <arf:report id="xccdf1">
+      <arf:content>
+        <TestResult xmlns="http://checklists.nist.gov/xccdf/1.2" id="xccdf_testresult">
+          <rule-result idref="xccdf_rule_sshd" severity="high">
+            <result>fail</result>
+            <message>PermitRootLogin is yes</message>
+            <message>in /etc/ssh/sshd_config</message>
+          </rule-result>
+        </TestResult>
+      </arf:content>
+    </arf:report>
+  </arf:reports>
+</arf:asset-report-collection>`
+
+func TestParseXCCDFResultsStatuses(t *testing.T) {
+	for _, test := range []struct {
+		result  string
+		status  string
+		message string
+		skip    string
+	}{
+		{"pass", "passed", "", ""},
+		{"fixed", "passed", "", ""},
+		{"fail", "failed", "fail", ""},
+		{"error", "failed", "error", ""},
+		{"unknown", "failed", "unknown", ""},
+		{"notapplicable", "skipped", "", "notapplicable"},
+		{"notchecked", "skipped", "", "notchecked"},
+		{"informational", "skipped", "", "informational"},
+	} {
+		output, err := ParseXCCDFResults([]byte(xccdfResults("low", test.result)))
+		if err != nil {
+			t.Fatalf("%s: %s", test.result, err)
+		}
+		if len(output.Controls) != 1 {
+			t.Fatalf("%s: got %d controls, want 1", test.result, len(output.Controls))
+		}
+		control := output.Controls[0]
+		if control.Status != test.status || control.Message != test.message || control.SkipMessage != test.skip {
+			t.Errorf("%s: status '%s', message '%s', skip message '%s', want '%s', '%s', '%s'",
+				test.result, control.Status, control.Message, control.SkipMessage, test.status, test.message, test.skip)
+		}
+		if control.ID != "rule_"+test.result || control.ProfileID != "xccdf_benchmark" {
+			t.Errorf("%s: control %s of profile %s", test.result, control.ID, control.ProfileID)
+		}
+		if control.Title != test.result+" title" || control.CodeDesc != control.Title {
+			t.Errorf("%s: title '%s', code_desc '%s'", test.result, control.Title, control.CodeDesc)
+		}
+		if control.Tags["result"] != test.result {
+			t.Errorf("%s: result tag %v", test.result, control.Tags["result"])
+		}
+	}
+}
+
+func TestParseXCCDFResultsLeavesOutUnselectedRules(t *testing.T) {
+	output, err := ParseXCCDFResults([]byte(xccdfResults("low", "pass", "notselected")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(output.Controls) != 1 || output.Controls[0].ID != "rule_pass" {
+		t.Errorf("got controls %v, want only rule_pass", output.Controls)
+	}
+}
+
+func TestParseXCCDFResultsImpacts(t *testing.T) {
+	for _, test := range []struct {
+		severity string
+		impact   float64
+	}{
+		{"high", 0.7},
+		{"medium", 0.5},
+		{"low", 0.3},
+		{"unknown", 0},
+		{"", 0},
+	} {
+		output, err := ParseXCCDFResults([]byte(xccdfResults(test.severity, "fail")))
+		if err != nil {
+			t.Fatalf("%s: %s", test.severity, err)
+		}
+		control := output.Controls[0]
+		if control.Impact != test.impact || control.Tags["severity"] != test.severity {
+			t.Errorf("severity '%s': impact %v, severity tag %v, want %v", test.severity, control.Impact, control.Tags["severity"], test.impact)
+		}
+	}
+}
+
+func TestParseXCCDFResultsARF(t *testing.T) {
+	output, err := ParseXCCDFResults([]byte(arfResults))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(output.Controls) != 1 {
+		t.Fatalf("got %d controls, want 1", len(output.Controls))
+	}
+	control := output.Controls[0]
+	if control.ProfileID != "xccdf_org.ssgproject.content_benchmark_RHEL-8" {
+		t.Errorf("profile = %s", control.ProfileID)
+	}
+	if control.Status != "failed" || control.Message != "PermitRootLogin is yes\nin /etc/ssh/sshd_config" {
+		t.Errorf("status '%s', message '%s'", control.Status, control.Message)
+	}
+	if control.Title != "Disable SSH Root Login" || control.Desc != "Root logins over SSH are disabled." {
+		t.Errorf("title '%s', desc '%s'", control.Title, control.Desc)
+	}
+	// the severity of the result overrides the one of the rule
+	if control.Impact != 0.7 || control.Tags["severity"] != "high" {
+		t.Errorf("impact %v, severity tag %v, want 0.7, high", control.Impact, control.Tags["severity"])
+	}
+}
+
+func TestParseXCCDFResultsErrors(t *testing.T) {
+	for _, data := range []string{
+		xccdfResults("low"),
+		`<Benchmark><TestResult>`,
+		`{"controls": []}`,
+	} {
+		if _, err := ParseXCCDFResults([]byte(data)); err == nil {
+			t.Errorf("ParseXCCDFResults(%q) succeeded", data)
+		}
+	}
+}
+
+func TestOscapEnv(t *testing.T) {
+	config := &Module{sshIdentityFile: "/keys/id_rsa"}
+	if env := oscapEnv("", config); env != nil {
+		t.Errorf("local scans got environment %v", env)
+	}
+	want := []string{"SSH_ADDITIONAL_OPTIONS=-i /keys/id_rsa"}
+	if env := oscapEnv("host1", config); !reflect.DeepEqual(env, want) {
+		t.Errorf("got environment %v, want %v", env, want)
+	}
+	if env := oscapEnv("host1", &Module{}); env != nil {
+		t.Errorf("scans without identity file got environment %v", env)
+	}
+}
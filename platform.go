@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/log"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+// Platform is the result of `inspec detect`.
+type Platform struct {
+	Name     string   `json:"name"`
+	Families []string `json:"families"`
+	Release  string   `json:"release"`
+	Arch     string   `json:"arch"`
+}
+
+// profileMetadata is the part of a profile's inspec.yml used for platform matching.
+type profileMetadata struct {
+	Supports []supportEntry `yaml:"supports"`
+}
+
+// supportEntry is an entry of `supports`. The short form of a plain platform
+// name, like `supports: [linux]`, is read as `platform: linux`.
+type supportEntry map[string]string
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (e *supportEntry) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var platform string
+	if err := unmarshal(&platform); err == nil {
+		*e = supportEntry{"platform": platform}
+		return nil
+	}
+	var entry map[string]string
+	if err := unmarshal(&entry); err != nil {
+		return err
+	}
+	*e = entry
+	return nil
+}
+
+type cachedPlatform struct {
+	platform Platform
+	expires  time.Time
+}
+
+var (
+	platformCacheMutex sync.Mutex
+	platformCache      = map[string]cachedPlatform{}
+)
+
+// DetectPlatform runs `inspec detect` against the target, using the transport
+// settings of the "auto" config section. Results are cached per target for
+// auto.cache_ttl (DEFAULT: 1h).
+func DetectPlatform(target string) (Platform, error) {
+	platformCacheMutex.Lock()
+	cached, ok := platformCache[target]
+	platformCacheMutex.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.platform, nil
+	}
+
+	config := loadModule("auto")
+	detectArgs := append([]string{"detect", "--format", "json"}, transportArgs(target, &config)...)
+	var platform Platform
+	detectCommand, cleanup, err := inspecCommand(&config, detectArgs...)
+	if err != nil {
+		return platform, err
+	}
+	defer cleanup()
+	log.Debugf("Detecting platform: %v", detectCommand.Args)
+	detectOutput, err := detectCommand.Output()
+	if err != nil {
+		return platform, err
+	}
+	err = json.Unmarshal(detectOutput, &platform)
+	if err != nil {
+		return platform, err
+	}
+
+	ttl := time.Hour
+	if viper.IsSet("auto.cache_ttl") {
+		ttl = viper.GetDuration("auto.cache_ttl")
+	}
+	platformCacheMutex.Lock()
+	platformCache[target] = cachedPlatform{platform: platform, expires: time.Now().Add(ttl)}
+	platformCacheMutex.Unlock()
+	return platform, nil
+}
+
+// matchesSelector reports whether a platform selector from the config equals
+// the platform name or one of its families.
+func (p Platform) matchesSelector(selector string) bool {
+	selector = strings.ToLower(selector)
+	return selector == strings.ToLower(p.Name) || include(p.Families, selector)
+}
+
+// matchesSupport reports whether a `supports` entry of a profile matches. All
+// keys of the entry have to match.
+func (p Platform) matchesSupport(entry supportEntry) bool {
+	for key, value := range entry {
+		switch key {
+		case "platform", "platform-family", "os-family":
+			if !p.matchesSelector(value) {
+				return false
+			}
+		case "platform-name", "os-name":
+			name := strings.ToLower(p.Name)
+			value = strings.ToLower(value)
+			if strings.HasSuffix(value, "*") {
+				if !strings.HasPrefix(name, strings.TrimSuffix(value, "*")) {
+					return false
+				}
+			} else if value != name {
+				return false
+			}
+		case "release":
+			if !strings.HasPrefix(p.Release, strings.TrimSuffix(value, "*")) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Supports reports whether the module should run on the platform. Configured
+// platform selectors take precedence over the profile's `supports` metadata;
+// a profile without either supports every platform, as do modules without
+// readable inspec.yml, like goss and OpenSCAP modules.
+func (p Platform) Supports(m *Module) bool {
+	if len(m.platforms) > 0 {
+		for _, selector := range m.platforms {
+			if p.matchesSelector(selector) {
+				return true
+			}
+		}
+		return false
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(m.path, "inspec.yml"))
+	if err != nil {
+		log.Debugf("Can't read metadata of module '%s', assuming it supports all platforms: %s", m.name, err)
+		return true
+	}
+	var metadata profileMetadata
+	if err := yaml.Unmarshal(content, &metadata); err != nil {
+		log.Warnf("Invalid metadata of module '%s', assuming it supports all platforms: %s", m.name, err)
+		return true
+	}
+	if len(metadata.Supports) == 0 {
+		return true
+	}
+	for _, entry := range metadata.Supports {
+		if p.matchesSupport(entry) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPlatformMatchesSupport(t *testing.T) {
+	ubuntu := Platform{Name: "ubuntu", Families: []string{"debian", "linux", "unix"}, Release: "18.04"}
+	for _, test := range []struct {
+		entry supportEntry
+		want  bool
+	}{
+		{supportEntry{}, true},
+		{supportEntry{"platform": "linux"}, true},
+		{supportEntry{"platform": "Ubuntu"}, true},
+		{supportEntry{"platform": "windows"}, false},
+		{supportEntry{"os-family": "debian"}, true},
+		{supportEntry{"platform-name": "ubuntu"}, true},
+		{supportEntry{"platform-name": "ubu*"}, true},
+		{supportEntry{"platform-name": "cent*"}, false},
+		{supportEntry{"platform-name": "ubuntu*", "release": "18.*"}, true},
+		{supportEntry{"platform-name": "ubuntu", "release": "16.*"}, false},
+		{supportEntry{"release": "18.04"}, true},
+		{supportEntry{"platform": "linux", "platform-name": "debian"}, false},
+	} {
+		if got := ubuntu.matchesSupport(test.entry); got != test.want {
+			t.Errorf("matchesSupport(%v) = %v, want %v", test.entry, got, test.want)
+		}
+	}
+}
+
+func TestPlatformSupports(t *testing.T) {
+	root, err := ioutil.TempDir("", "inspec_exporter_platform")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for name, metadata := range map[string]string{
+		"windows": "supports:\n  - platform: windows\n",
+		"short":   "supports: [linux]\n",
+		"none":    "name: none\n",
+		"invalid": "supports: {",
+	} {
+		if err := os.MkdirAll(filepath.Join(root, name), 0750); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(root, name, "inspec.yml"), []byte(metadata), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ubuntu := Platform{Name: "ubuntu", Families: []string{"debian", "linux", "unix"}}
+	for _, test := range []struct {
+		module Module
+		want   bool
+	}{
+		{Module{name: "windows", path: filepath.Join(root, "windows")}, false},
+		{Module{name: "short", path: filepath.Join(root, "short")}, true},
+		{Module{name: "none", path: filepath.Join(root, "none")}, true},
+		{Module{name: "invalid", path: filepath.Join(root, "invalid")}, true},
+		{Module{name: "goss", path: filepath.Join(root, "goss.yaml")}, true},
+		{Module{name: "windows", path: filepath.Join(root, "windows"), platforms: []string{"linux"}}, true},
+	} {
+		if got := ubuntu.Supports(&test.module); got != test.want {
+			t.Errorf("Supports(%s) = %v, want %v", test.module.name, got, test.want)
+		}
+	}
+}
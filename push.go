@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/log"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	pushCommand         = kingpin.Command("push", "Scan targets once and push the metrics to a Pushgateway.")
+	pushURL             = pushCommand.Flag("push.url", "URL of the Pushgateway.").Required().URL()
+	pushJob             = pushCommand.Flag("push.job", "Job name of the pushed metrics.").Default("inspec").String()
+	pushTargets         = pushCommand.Flag("target", "Target to scan, can be repeated (DEFAULT: local).").Strings()
+	pushModules         = pushCommand.Flag("module", "Module to run, can be repeated (DEFAULT: all modules).").Strings()
+	pushUsername        = pushCommand.Flag("push.username", "Username for basic auth at the Pushgateway.").Envar("INSPEC_PUSH_USERNAME").String()
+	pushPassword        = pushCommand.Flag("push.password", "Password for basic auth at the Pushgateway.").Envar("INSPEC_PUSH_PASSWORD").String()
+	pushTimeout         = pushCommand.Flag("push.timeout", "Timeout of requests to the Pushgateway.").Default("30s").Duration()
+	pushDeleteOnSuccess = pushCommand.Flag("push.delete-on-success", "Replace the group of a target and module by a successful scan, so metrics of removed controls vanish.").Bool()
+)
+
+// groupingKeyPath encodes a label of the grouping key as Pushgateway URL path,
+// using base64 for values which are empty or contain a slash.
+func groupingKeyPath(name string, value string) string {
+	if value == "" {
+		return name + "@base64/="
+	}
+	if strings.Contains(value, "/") {
+		return name + "@base64/" + base64.URLEncoding.EncodeToString([]byte(value))
+	}
+	return name + "/" + url.PathEscape(value)
+}
+
+// pushGroup sends a request for the group of the job, target and module.
+func pushGroup(client *http.Client, method string, target string, module string, body []byte) error {
+	groupURL := strings.TrimRight((*pushURL).String(), "/") + "/metrics/job/" + url.PathEscape(*pushJob) +
+		"/" + groupingKeyPath("target", target) + "/" + groupingKeyPath("module", module)
+	request, err := http.NewRequest(method, groupURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", string(expfmt.FmtText))
+	if *pushUsername != "" {
+		request.SetBasicAuth(*pushUsername, *pushPassword)
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(response.Body)
+		return fmt.Errorf("%s %s returned %s: %s", method, groupURL, response.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// runPush implements the push command and returns the exit code.
+func runPush() int {
+	targets := *pushTargets
+	if len(targets) == 0 {
+		targets = []string{""}
+	}
+	modules := *pushModules
+	if len(modules) == 0 {
+		names, err := moduleNames()
+		if err != nil {
+			log.Errorf("'profile_path' is not readable: %s", err)
+			return 2
+		}
+		modules = names
+	}
+
+	client := &http.Client{Timeout: *pushTimeout}
+	exitCode := 0
+	for _, target := range targets {
+		for _, module := range modules {
+			if !moduleExists(module) {
+				log.Errorf("Unkown module '%s'", module)
+				exitCode = 2
+				continue
+			}
+			m := loadModule(module)
+			start := time.Now()
+			body, err := gatherText(collector{target: target, module: &m})
+			if err != nil {
+				log.Errorf("Error scanning target %s with module %s: %s", target, module, err)
+				exitCode = 1
+				continue
+			}
+			// PUT replaces all metrics of the group, POST only those with the same name
+			method := http.MethodPost
+			if *pushDeleteOnSuccess {
+				method = http.MethodPut
+			}
+			if err := pushGroup(client, method, target, module, body); err != nil {
+				log.Errorf("Error pushing target %s and module %s: %s", target, module, err)
+				exitCode = 1
+				continue
+			}
+			log.Infof("Pushed target '%s' with module '%s' in %s", target, module, time.Since(start))
+		}
+	}
+	return exitCode
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/log"
+	"github.com/spf13/viper"
+)
+
+// Replay serves recorded reports from <directory>/<target>/<module>/*.json
+// instead of running inspec. Every scan returns the next file in name order,
+// restarting at the first one if cycle is set and repeating the last one
+// otherwise. Scans without a target use the target directory _local.
+type Replay struct {
+	dir       string
+	cycle     bool
+	mutex     sync.Mutex
+	positions map[string]int
+}
+
+// NewReplay creates the replay source for dir.
+func NewReplay(dir string, cycle bool) *Replay {
+	return &Replay{dir: dir, cycle: cycle, positions: map[string]int{}}
+}
+
+// fixtures returns the report files of the target and module in name order.
+func (r *Replay) fixtures(target string, module string) ([]string, error) {
+	dir := filepath.Join(r.dir, escapeTarget(target), escapeSegment(module))
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no recorded reports in %s", dir)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Modules returns the modules with recorded reports of the target.
+func (r *Replay) Modules(target string) ([]string, error) {
+	entries, err := ioutil.ReadDir(filepath.Join(r.dir, escapeTarget(target)))
+	if err != nil {
+		return nil, err
+	}
+	modules := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			module, err := url.PathUnescape(entry.Name())
+			if err != nil {
+				module = entry.Name()
+			}
+			modules = append(modules, module)
+		}
+	}
+	return modules, nil
+}
+
+// Scan returns the next recorded report of the target and module.
+func (r *Replay) Scan(ctx context.Context, target string, config *Module) (*ScanResult, error) {
+	files, err := r.fixtures(target, config.name)
+	if err != nil {
+		return nil, err
+	}
+	key := target + "\x00" + config.name
+	r.mutex.Lock()
+	position := r.positions[key]
+	switch {
+	case position+1 < len(files):
+		r.positions[key] = position + 1
+	case r.cycle:
+		r.positions[key] = 0
+	}
+	r.mutex.Unlock()
+	if position >= len(files) {
+		position = len(files) - 1
+	}
+
+	result := &ScanResult{Start: time.Now(), Args: []string{"replay", files[position]}}
+	result.Raw, err = ioutil.ReadFile(files[position])
+	if err != nil {
+		return result, err
+	}
+	parseStart := time.Now()
+	result.Output, err = ParseInspecReport(result.Raw)
+	result.ParseDuration = time.Since(parseStart)
+	if err != nil {
+		return result, fmt.Errorf("parsing recorded report %s failed: %s", files[position], err)
+	}
+	result.Duration = time.Duration(result.Output.Statistics.Duration * float64(time.Second))
+	for _, status := range controlStatuses(result.Output) {
+		if status == "failed" {
+			result.ExitCode = 100
+		}
+	}
+	return result, nil
+}
+
+// replaySource holds the recorded reports in replay mode, nil otherwise.
+var replaySource *Replay
+
+// targetModules returns the modules of the target: those with recorded reports
+// in replay mode, all configured modules otherwise.
+func targetModules(target string) ([]string, error) {
+	if replaySource != nil {
+		return replaySource.Modules(target)
+	}
+	return moduleNames()
+}
+
+// targetModuleExists reports whether the module can be scanned on the target.
+func targetModuleExists(target string, module string) bool {
+	if replaySource == nil {
+		return moduleExists(module)
+	}
+	modules, err := replaySource.Modules(target)
+	return err == nil && include(modules, module)
+}
+
+// startReplay replaces inspec by the recorded reports of replay.directory if
+// it is configured.
+func startReplay() {
+	if !viper.IsSet("replay.directory") {
+		return
+	}
+	cycle := true
+	if viper.IsSet("replay.cycle") {
+		cycle = viper.GetBool("replay.cycle")
+	}
+	replaySource = NewReplay(viper.GetString("replay.directory"), cycle)
+	replayScanner = replaySource
+	log.Infof("Replaying recorded reports from %s", viper.GetString("replay.directory"))
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestReplayModulesKeepsLocalModuleName(t *testing.T) {
+	root, err := ioutil.TempDir("", "inspec_exporter_replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for _, module := range []string{"_local", "linux%2Fbaseline"} {
+		if err := os.MkdirAll(filepath.Join(root, localTarget, module), 0750); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	modules, err := NewReplay(root, false).Modules("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(modules)
+	if want := []string{"_local", "linux/baseline"}; !reflect.DeepEqual(modules, want) {
+		t.Errorf("Modules = %q, want %q", modules, want)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+// reportControl is a control with all its results.
+type reportControl struct {
+	ID      string
+	Status  string
+	Results []InspecControl
+}
+
+// reportGroup holds the controls of a profile with the same status.
+type reportGroup struct {
+	Status   string
+	Controls []reportControl
+}
+
+// reportProfile holds the controls of a profile grouped by status.
+type reportProfile struct {
+	Name   string
+	Groups []reportGroup
+}
+
+// reportPage is the data of the report template.
+type reportPage struct {
+	Target      string
+	Module      string
+	Start       time.Time
+	Duration    float64
+	ExitStatus  int
+	Error       string
+	Score       float64
+	Passed      int
+	Failed      int
+	Skipped     int
+	Profiles    []reportProfile
+	HasPrevious bool
+}
+
+// statusOrder sorts the groups of a profile, failures first.
+var statusOrder = []string{"failed", "passed", "skipped"}
+
+// newReportPage builds the report of a stored scan.
+func newReportPage(record *ScanRecord, hasPrevious bool) reportPage {
+	page := reportPage{
+		Target:      record.Target,
+		Module:      record.Module,
+		Start:       record.Start,
+		Duration:    record.Duration,
+		ExitStatus:  record.ExitStatus,
+		Error:       record.Error,
+		HasPrevious: hasPrevious,
+	}
+	result, err := record.Result()
+	if err != nil {
+		page.Error = err.Error()
+		return page
+	}
+
+	statuses := controlStatuses(result.Output)
+	profiles := map[string]map[string]*reportControl{}
+	for _, check := range result.Output.Controls {
+		if profiles[check.ProfileID] == nil {
+			profiles[check.ProfileID] = map[string]*reportControl{}
+		}
+		control := profiles[check.ProfileID][check.ID]
+		if control == nil {
+			control = &reportControl{ID: check.ID, Status: statuses[controlKey(check.ProfileID, check.ID)]}
+			profiles[check.ProfileID][check.ID] = control
+		}
+		control.Results = append(control.Results, check)
+	}
+	for _, status := range statuses {
+		switch status {
+		case "passed":
+			page.Passed++
+		case "failed":
+			page.Failed++
+		default:
+			page.Skipped++
+		}
+	}
+	if page.Passed+page.Failed > 0 {
+		page.Score = 100 * float64(page.Passed) / float64(page.Passed+page.Failed)
+	}
+
+	names := []string{}
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		profile := reportProfile{Name: name}
+		for _, status := range statusOrder {
+			group := reportGroup{Status: status}
+			for _, control := range profiles[name] {
+				if control.Status == status || (status == "skipped" && control.Status != "passed" && control.Status != "failed") {
+					group.Controls = append(group.Controls, *control)
+				}
+			}
+			sort.Slice(group.Controls, func(i, j int) bool { return group.Controls[i].ID < group.Controls[j].ID })
+			if len(group.Controls) > 0 {
+				profile.Groups = append(profile.Groups, group)
+			}
+		}
+		page.Profiles = append(page.Profiles, profile)
+	}
+	return page
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(reportHTML))
+
+// reportHandler renders the latest stored scan of a target and module as HTML.
+func reportHandler(w http.ResponseWriter, r *http.Request) {
+	if resultStore == nil {
+		http.Error(w, "no result store configured", http.StatusNotFound)
+		inspecRequestErrors.Inc()
+		return
+	}
+	target := r.URL.Query().Get("target")
+	module := r.URL.Query().Get("module")
+	if module == "" {
+		http.Error(w, "'module' parameter is missing", http.StatusBadRequest)
+		inspecRequestErrors.Inc()
+		return
+	}
+	records, err := resultStore.History(target, module, 2)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		inspecRequestErrors.Inc()
+		return
+	}
+	if len(records) == 0 {
+		http.Error(w, fmt.Sprintf("no stored result for target '%s' and module '%s'", target, module), http.StatusNotFound)
+		inspecRequestErrors.Inc()
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := reportTemplate.Execute(w, newReportPage(records[0], len(records) > 1)); err != nil {
+		log.Errorf("Error rendering report: %s", err)
+	}
+}
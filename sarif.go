@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool       sarifTool              `json:"tool"`
+	Results    []sarifResult          `json:"results"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version,omitempty"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifRule struct {
+	ID                   string                 `json:"id"`
+	Name                 string                 `json:"name,omitempty"`
+	ShortDescription     *sarifMessage          `json:"shortDescription,omitempty"`
+	FullDescription      *sarifMessage          `json:"fullDescription,omitempty"`
+	DefaultConfiguration sarifConfiguration     `json:"defaultConfiguration"`
+	Properties           map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations"`
+}
+
+type sarifLogicalLocation struct {
+	Name               string `json:"name"`
+	FullyQualifiedName string `json:"fullyQualifiedName,omitempty"`
+	Kind               string `json:"kind"`
+}
+
+// sarifLevel maps the impact of a control to a SARIF level, following the
+// inspec severities: high and critical (>= 0.7) are errors, medium (>= 0.4)
+// warnings and everything below notes.
+func sarifLevel(impact float64) string {
+	switch {
+	case impact >= 0.7:
+		return "error"
+	case impact >= 0.4:
+		return "warning"
+	}
+	return "note"
+}
+
+// renderSARIF renders the result as SARIF 2.1.0 log. Every control becomes a
+// rule and every failed result a finding located on the target.
+func renderSARIF(target string, module string, result *ScanResult) ([]byte, error) {
+	host := target
+	if host == "" {
+		host = "localhost"
+	}
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "inspec",
+			Version:        result.Output.Version,
+			InformationURI: "https://www.inspec.io/",
+			Rules:          []sarifRule{},
+		}},
+		Results: []sarifResult{},
+		Properties: map[string]interface{}{
+			"target": target,
+			"module": module,
+		},
+	}
+
+	keys := []string{}
+	controls := map[string]InspecControl{}
+	profiles := map[string]map[string]bool{}
+	for _, check := range result.Output.Controls {
+		key := controlKey(check.ProfileID, check.ID)
+		if _, ok := controls[key]; !ok {
+			keys = append(keys, key)
+			controls[key] = check
+		}
+		if profiles[check.ID] == nil {
+			profiles[check.ID] = map[string]bool{}
+		}
+		profiles[check.ID][check.ProfileID] = true
+	}
+	sort.Strings(keys)
+	// rule IDs must be unique, controls of several profiles get the profile as prefix
+	ruleID := func(profile string, id string) string {
+		if len(profiles[id]) > 1 {
+			return profile + "/" + id
+		}
+		return id
+	}
+	ruleIndex := map[string]int{}
+	for i, key := range keys {
+		control := controls[key]
+		rule := sarifRule{
+			ID:                   ruleID(control.ProfileID, control.ID),
+			Name:                 control.Title,
+			DefaultConfiguration: sarifConfiguration{Level: sarifLevel(control.Impact)},
+			Properties: map[string]interface{}{
+				"impact":            control.Impact,
+				"security-severity": fmt.Sprintf("%.1f", control.Impact*10),
+				"profile":           control.ProfileID,
+			},
+		}
+		if control.Title != "" {
+			rule.ShortDescription = &sarifMessage{Text: control.Title}
+		}
+		if control.Desc != "" {
+			rule.FullDescription = &sarifMessage{Text: control.Desc}
+		}
+		if len(control.Tags) > 0 {
+			rule.Properties["tags"] = control.Tags
+		}
+		ruleIndex[key] = i
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, rule)
+	}
+
+	for _, check := range result.Output.Controls {
+		if check.Status != "failed" {
+			continue
+		}
+		message := check.CodeDesc
+		if check.Message != "" {
+			message += "\n" + check.Message
+		}
+		location := sarifLogicalLocation{Name: host, Kind: "resource"}
+		if check.Resource != "" {
+			location.FullyQualifiedName = host + "/" + check.Resource
+		}
+		run.Results = append(run.Results, sarifResult{
+			RuleID:    ruleID(check.ProfileID, check.ID),
+			RuleIndex: ruleIndex[controlKey(check.ProfileID, check.ID)],
+			Level:     sarifLevel(check.Impact),
+			Message:   sarifMessage{Text: message},
+			Locations: []sarifLocation{{LogicalLocations: []sarifLogicalLocation{location}}},
+		})
+	}
+
+	content, err := json.MarshalIndent(sarifLog{Schema: sarifSchema, Version: "2.1.0", Runs: []sarifRun{run}}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(content, '\n'), nil
+}
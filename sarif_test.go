@@ -0,0 +1,28 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRenderSARIFSharedControlIDs(t *testing.T) {
+	content, err := renderSARIF("host", "module", &ScanResult{Output: parseOutput(t, sharedControls)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var log sarifLog
+	if err := json.Unmarshal(content, &log); err != nil {
+		t.Fatal(err)
+	}
+	run := log.Runs[0]
+	ids := []string{}
+	for _, rule := range run.Tool.Driver.Rules {
+		ids = append(ids, rule.ID)
+	}
+	if len(ids) != 3 || ids[0] != "p1/c1" || ids[1] != "p2/c1" || ids[2] != "c2" {
+		t.Errorf("rules = %v, want p1/c1, p2/c1 and c2", ids)
+	}
+	if len(run.Results) != 1 || run.Results[0].RuleID != "p2/c1" || run.Results[0].RuleIndex != 1 {
+		t.Errorf("results = %+v, want the failure of p2/c1", run.Results)
+	}
+}
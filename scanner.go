@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+
+	"github.com/prometheus/common/log"
+)
+
+// Scanner runs a module against a target and maps the results to the
+// control model of the inspec json-min reporter.
+type Scanner interface {
+	Scan(ctx context.Context, target string, config *Module) (*ScanResult, error)
+}
+
+// ScannerFunc adapts a function to the Scanner interface.
+type ScannerFunc func(ctx context.Context, target string, config *Module) (*ScanResult, error)
+
+// Scan implements Scanner.
+func (f ScannerFunc) Scan(ctx context.Context, target string, config *Module) (*ScanResult, error) {
+	return f(ctx, target, config)
+}
+
+// scanners are the backends selectable with the scanner setting of a module.
+var scanners = map[string]Scanner{
+	"inspec": ScannerFunc(RunInspec),
+	"oscap":  ScannerFunc(RunOscap),
+	"goss":   ScannerFunc(RunGoss),
+}
+
+// replayScanner replaces all scanners in replay mode.
+var replayScanner Scanner
+
+// moduleCommand prepares a scanner process with the environment and working
+// directory of the module. With isolateHome the process gets its own HOME,
+// which the returned function removes after the run.
+func moduleCommand(config *Module, name string, args ...string) (*exec.Cmd, func(), error) {
+	cmd := exec.Command(name, args...)
+	cmd.Env = append(os.Environ(), config.env...)
+	cmd.Dir = config.workDir
+	setProcessGroup(cmd)
+	if !config.isolateHome {
+		return cmd, func() {}, nil
+	}
+	home, err := ioutil.TempDir("", "inspec_exporter_home")
+	if err != nil {
+		return nil, nil, err
+	}
+	// later values win, so this overrides HOME of the exporter
+	cmd.Env = append(cmd.Env, "HOME="+home, "XDG_CACHE_HOME="+filepath.Join(home, ".cache"))
+	return cmd, func() { os.RemoveAll(home) }, nil
+}
+
+// runCommand runs the command until it exits or ctx is done. It then kills
+// the whole process group, so children of the command holding its output open
+// don't block the run.
+func runCommand(ctx context.Context, cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			if err := killProcessGroup(cmd); err != nil {
+				log.Debugf("Error killing %v: %s", cmd.Args[0], err)
+			}
+		case <-done:
+		}
+	}()
+	return cmd.Wait()
+}
+
+// exitCode returns the exit status of a command which failed with err, or 0
+// if it didn't exit.
+func exitCode(err error) int {
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			return status.ExitStatus()
+		}
+	}
+	return 0
+}
+
+// storeMappedOutput keeps the output of a scanner which isn't inspec as the
+// raw report, since the store only holds inspec reports.
+func storeMappedOutput(result *ScanResult) error {
+	raw, err := json.Marshal(result.Output)
+	if err != nil {
+		return err
+	}
+	result.Raw = raw
+	return nil
+}
+
+// executeScan runs the module against the target with its scanner, or
+// returns the recorded reports in replay mode.
+func executeScan(ctx context.Context, target string, config *Module) (*ScanResult, error) {
+	if replayScanner != nil {
+		return replayScanner.Scan(ctx, target, config)
+	}
+	if err := ensureCheckout(config); err != nil {
+		return nil, err
+	}
+	scanner, ok := scanners[config.scanner]
+	if !ok {
+		return nil, fmt.Errorf("unknown scanner '%s' of module '%s'", config.scanner, config.name)
+	}
+	return scanner.Scan(ctx, target, config)
+}
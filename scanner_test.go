@@ -0,0 +1,24 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStoreMappedOutput(t *testing.T) {
+	output, err := ParseGossResults([]byte(gossResults), "base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := &ScanResult{Output: output}
+	if err := storeMappedOutput(result); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := newScanRecord("host", "base", result, nil).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stored.Output, output) {
+		t.Errorf("stored report = %+v, want %+v", stored.Output, output)
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/prometheus/common/log"
+	"github.com/spf13/viper"
+)
+
+// defaultSpoolPattern matches <target>__<module>.json.
+const defaultSpoolPattern = `^(?P<target>.+?)__(?P<module>.+)\.json$`
+
+// spoolSettle is the time a file has to be unchanged before it is processed.
+const spoolSettle = time.Second
+
+// reportMetadata is the part of an inspec json report identifying target and module.
+type reportMetadata struct {
+	Platform struct {
+		TargetID string `json:"target_id"`
+	} `json:"platform"`
+	Profiles []struct {
+		Name string `json:"name"`
+	} `json:"profiles"`
+	Controls []struct {
+		ProfileID string `json:"profile_id"`
+	} `json:"controls"`
+}
+
+// Spool ingests report files written to a directory into the result store.
+// Processed files are moved to the done subdirectory, broken ones to error.
+type Spool struct {
+	dir     string
+	pattern *regexp.Regexp
+	mutex   sync.Mutex
+	pending map[string]*time.Timer
+}
+
+// NewSpool creates the spool for dir. The pattern must contain the named
+// groups target and/or module, missing values are taken from the report.
+func NewSpool(dir string, pattern string) (*Spool, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid spool.pattern: %s", err)
+	}
+	for _, sub := range []string{"done", "error"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0750); err != nil {
+			return nil, err
+		}
+	}
+	return &Spool{dir: dir, pattern: re, pending: map[string]*time.Timer{}}, nil
+}
+
+// Watch processes existing files and then watches the directory until the
+// watcher fails.
+func (s *Spool) Watch() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	if err := watcher.Add(s.dir); err != nil {
+		return err
+	}
+
+	entries, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			s.schedule(entry.Name())
+		}
+	}
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op&(fsnotify.Create|fsnotify.Write) != 0 {
+				s.schedule(filepath.Base(event.Name))
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Errorf("Error watching spool directory %s: %s", s.dir, err)
+		}
+	}
+}
+
+// schedule processes the file once it wasn't changed for spoolSettle.
+func (s *Spool) schedule(name string) {
+	if strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".tmp") {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if timer, ok := s.pending[name]; ok {
+		timer.Reset(spoolSettle)
+		return
+	}
+	s.pending[name] = time.AfterFunc(spoolSettle, func() {
+		s.mutex.Lock()
+		delete(s.pending, name)
+		s.mutex.Unlock()
+		s.process(name)
+	})
+}
+
+// identify returns the target and module of a report file.
+func (s *Spool) identify(name string, data []byte) (string, string, error) {
+	target, module := "", ""
+	if match := s.pattern.FindStringSubmatch(name); match != nil {
+		for i, group := range s.pattern.SubexpNames() {
+			switch group {
+			case "target":
+				target = match[i]
+			case "module":
+				module = match[i]
+			}
+		}
+	}
+	if target == "" || module == "" {
+		var metadata reportMetadata
+		if err := json.Unmarshal(data, &metadata); err != nil {
+			return "", "", err
+		}
+		if target == "" {
+			target = metadata.Platform.TargetID
+		}
+		if module == "" && len(metadata.Profiles) > 0 {
+			module = metadata.Profiles[0].Name
+		}
+		if module == "" && len(metadata.Controls) > 0 {
+			module = metadata.Controls[0].ProfileID
+		}
+	}
+	if target == "" || module == "" {
+		return "", "", fmt.Errorf("can't determine target and module")
+	}
+	return target, module, nil
+}
+
+// process ingests a report file and moves it to done or error.
+func (s *Spool) process(name string) {
+	file := filepath.Join(s.dir, name)
+	info, err := os.Stat(file)
+	if err != nil || info.IsDir() {
+		return
+	}
+	err = s.ingest(file, name, info.ModTime())
+	sub := "done"
+	if err != nil {
+		sub = "error"
+		ingestedReports.WithLabelValues("spool", "error").Inc()
+		log.Errorf("Error ingesting spool file %s: %s", file, err)
+	} else {
+		ingestedReports.WithLabelValues("spool", "success").Inc()
+	}
+	if err := os.Rename(file, filepath.Join(s.dir, sub, name)); err != nil {
+		log.Errorf("Error moving spool file %s: %s", file, err)
+	}
+}
+
+func (s *Spool) ingest(file string, name string, modTime time.Time) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	target, module, err := s.identify(name, data)
+	if err != nil {
+		return err
+	}
+	if !pushedModule(module) {
+		return fmt.Errorf("module '%s' does not accept pushed reports", module)
+	}
+	return ingestReport(target, module, "spool", data, modTime)
+}
+
+// startSpool watches spool.directory if it is configured.
+func startSpool() error {
+	if !viper.IsSet("spool.directory") {
+		return nil
+	}
+	if resultStore == nil {
+		return fmt.Errorf("spool.directory needs the result store")
+	}
+	pattern := defaultSpoolPattern
+	if viper.IsSet("spool.pattern") {
+		pattern = viper.GetString("spool.pattern")
+	}
+	spool, err := NewSpool(viper.GetString("spool.directory"), pattern)
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := spool.Watch(); err != nil {
+			log.Errorf("Error watching spool directory %s: %s", spool.dir, err)
+		}
+	}()
+	log.Infof("Watching spool directory %s", spool.dir)
+	return nil
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// localTarget is the directory name of scans run without a target.
+const localTarget = "_local"
+
+// resultStore is the global result store, nil if store.path is not configured.
+var resultStore *ResultStore
+
+// ScanRecord is a stored scan of a target with a module.
+type ScanRecord struct {
+	Target     string          `json:"target"`
+	Module     string          `json:"module"`
+	Start      time.Time       `json:"start"`
+	Duration   float64         `json:"duration_seconds"`
+	ExitStatus int             `json:"exit_status"`
+	Error      string          `json:"error,omitempty"`
+	Source     string          `json:"source,omitempty"`
+	Report     json.RawMessage `json:"report,omitempty"`
+}
+
+// newScanRecord builds the record of a scan result and the error it returned.
+func newScanRecord(target string, module string, result *ScanResult, err error) *ScanRecord {
+	record := &ScanRecord{
+		Target:     target,
+		Module:     module,
+		Start:      result.Start,
+		Duration:   result.Duration.Seconds(),
+		ExitStatus: result.ExitCode,
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	if json.Valid(result.Raw) {
+		record.Report = result.Raw
+	}
+	return record
+}
+
+// Result converts the record back to the result of the scan.
+func (r *ScanRecord) Result() (*ScanResult, error) {
+	result := &ScanResult{
+		Raw:      r.Report,
+		ExitCode: r.ExitStatus,
+		Start:    r.Start,
+		Duration: time.Duration(r.Duration * float64(time.Second)),
+	}
+	if r.Error != "" {
+		return result, errors.New(r.Error)
+	}
+	output, err := ParseInspecReport(r.Report)
+	result.Output = output
+	return result, err
+}
+
+// pruneInterval is the interval of applying the retention to the whole store.
+const pruneInterval = time.Hour
+
+// ResultStore keeps scan records on disk in <path>/<target>/<module>/<start>.json.
+type ResultStore struct {
+	path     string
+	maxAge   time.Duration
+	maxCount int
+	pruned   time.Time
+	mutex    sync.Mutex
+}
+
+// NewResultStore opens the store in path, creating it if necessary. Records
+// older than maxAge or beyond the maxCount newest per target and module are
+// removed on save, and in the whole store on opening and every pruneInterval
+// of saves; zero disables the limit.
+func NewResultStore(path string, maxAge time.Duration, maxCount int) (*ResultStore, error) {
+	if err := os.MkdirAll(path, 0750); err != nil {
+		return nil, err
+	}
+	s := &ResultStore{path: path, maxAge: maxAge, maxCount: maxCount}
+	if err := s.pruneAll(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// escapeSegment encodes a target or module as a single path segment. Dots are
+// encoded in "." and "..", which url.PathEscape leaves unchanged.
+func escapeSegment(name string) string {
+	escaped := url.PathEscape(name)
+	if escaped == "." || escaped == ".." {
+		return strings.Replace(escaped, ".", "%2E", -1)
+	}
+	return escaped
+}
+
+func escapeTarget(target string) string {
+	if target == "" {
+		return localTarget
+	}
+	return escapeSegment(target)
+}
+
+func unescapeTarget(dir string) string {
+	if dir == localTarget {
+		return ""
+	}
+	target, err := url.PathUnescape(dir)
+	if err != nil {
+		return dir
+	}
+	return target
+}
+
+// dir returns the directory of the records of the target and module, which
+// must be inside the store.
+func (s *ResultStore) dir(target string, module string) (string, error) {
+	if module == "" {
+		return "", errors.New("module must not be empty")
+	}
+	dir := filepath.Join(s.path, escapeTarget(target), escapeSegment(module))
+	if filepath.Dir(filepath.Dir(dir)) != filepath.Clean(s.path) {
+		return "", fmt.Errorf("invalid target '%s' or module '%s'", target, module)
+	}
+	return dir, nil
+}
+
+// recordStart returns the start of the scan encoded in the name of a record
+// file. It reports false for other files.
+func recordStart(name string) (time.Time, bool) {
+	if !strings.HasSuffix(name, ".json") {
+		return time.Time{}, false
+	}
+	nanos, err := strconv.ParseInt(strings.TrimSuffix(name, ".json"), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, nanos), true
+}
+
+// Save writes the record and applies the retention of its target and module.
+func (s *ResultStore) Save(record *ScanRecord) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	dir, err := s.dir(record.Target, record.Module)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return err
+	}
+	content, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(dir, fmt.Sprintf("%d.json", record.Start.UnixNano()))
+	if err := ioutil.WriteFile(file+".tmp", content, 0640); err != nil {
+		return err
+	}
+	if err := os.Rename(file+".tmp", file); err != nil {
+		return err
+	}
+	if time.Since(s.pruned) >= pruneInterval {
+		return s.pruneAll()
+	}
+	return s.prune(dir)
+}
+
+// files returns the record files in dir, newest first. Files not named
+// after the start of a scan are ignored.
+func (s *ResultStore) files(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, entry := range entries {
+		if _, ok := recordStart(entry.Name()); ok && !entry.IsDir() {
+			files = append(files, entry.Name())
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(files)))
+	return files, nil
+}
+
+func (s *ResultStore) prune(dir string) error {
+	files, err := s.files(dir)
+	if err != nil {
+		return err
+	}
+	for i, file := range files {
+		start, _ := recordStart(file)
+		tooOld := s.maxAge > 0 && time.Since(start) > s.maxAge
+		tooMany := s.maxCount > 0 && i >= s.maxCount
+		if tooOld || tooMany {
+			if err := os.Remove(filepath.Join(dir, file)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// pruneAll applies the retention to all targets and modules and removes
+// the directories left empty.
+func (s *ResultStore) pruneAll() error {
+	targets, err := ioutil.ReadDir(s.path)
+	if err != nil {
+		return err
+	}
+	for _, target := range targets {
+		if !target.IsDir() {
+			continue
+		}
+		targetDir := filepath.Join(s.path, target.Name())
+		modules, err := ioutil.ReadDir(targetDir)
+		if err != nil {
+			return err
+		}
+		for _, module := range modules {
+			if !module.IsDir() {
+				continue
+			}
+			dir := filepath.Join(targetDir, module.Name())
+			if err := s.prune(dir); err != nil {
+				return err
+			}
+			// fails for directories which are not empty
+			os.Remove(dir)
+		}
+		os.Remove(targetDir)
+	}
+	s.pruned = time.Now()
+	return nil
+}
+
+func (s *ResultStore) read(file string) (*ScanRecord, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var record ScanRecord
+	if err := json.Unmarshal(content, &record); err != nil {
+		return nil, fmt.Errorf("invalid record %s: %s", file, err)
+	}
+	return &record, nil
+}
+
+// History returns up to limit records of the target and module, newest
+// first. A limit of zero returns all records.
+func (s *ResultStore) History(target string, module string, limit int) ([]*ScanRecord, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	dir, err := s.dir(target, module)
+	if err != nil {
+		return nil, err
+	}
+	files, err := s.files(dir)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && len(files) > limit {
+		files = files[:limit]
+	}
+	records := []*ScanRecord{}
+	for _, file := range files {
+		record, err := s.read(filepath.Join(dir, file))
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// Window returns the records of the target and module started within window
+// of the newest one, but at least min records if there are, newest first.
+// Older records are not read.
+func (s *ResultStore) Window(target string, module string, window time.Duration, min int) ([]*ScanRecord, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	dir, err := s.dir(target, module)
+	if err != nil {
+		return nil, err
+	}
+	files, err := s.files(dir)
+	if err != nil {
+		return nil, err
+	}
+	records := []*ScanRecord{}
+	if len(files) == 0 {
+		return records, nil
+	}
+	newest, _ := recordStart(files[0])
+	for i, file := range files {
+		start, _ := recordStart(file)
+		if i >= min && start.Before(newest.Add(-window)) {
+			break
+		}
+		record, err := s.read(filepath.Join(dir, file))
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// Walk calls fn with the records of the target and module, newest first,
+// until it returns false. Older records are not read. fn must not use the
+// store.
+func (s *ResultStore) Walk(target string, module string, fn func(*ScanRecord) bool) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	dir, err := s.dir(target, module)
+	if err != nil {
+		return err
+	}
+	files, err := s.files(dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		record, err := s.read(filepath.Join(dir, file))
+		if err != nil {
+			return err
+		}
+		if !fn(record) {
+			break
+		}
+	}
+	return nil
+}
+
+// Latest returns the newest record of the target and module, nil if there is none.
+func (s *ResultStore) Latest(target string, module string) (*ScanRecord, error) {
+	records, err := s.History(target, module, 1)
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	return records[0], nil
+}
+
+// Targets returns all targets with stored records.
+func (s *ResultStore) Targets() ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entries, err := ioutil.ReadDir(s.path)
+	if err != nil {
+		return nil, err
+	}
+	targets := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			targets = append(targets, unescapeTarget(entry.Name()))
+		}
+	}
+	return targets, nil
+}
+
+// Modules returns all modules with stored records for the target.
+func (s *ResultStore) Modules(target string) ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entries, err := ioutil.ReadDir(filepath.Join(s.path, escapeTarget(target)))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	modules := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			module, err := url.PathUnescape(entry.Name())
+			if err != nil {
+				module = entry.Name()
+			}
+			modules = append(modules, module)
+		}
+	}
+	return modules, nil
+}
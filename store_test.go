@@ -0,0 +1,171 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResultStoreStaysInPath(t *testing.T) {
+	root, err := ioutil.TempDir("", "inspec_exporter_store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	store, err := NewResultStore(filepath.Join(root, "a", "store"), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{".", "..", "../..", "a/b", `a\b`} {
+		record := &ScanRecord{Target: name, Module: name, Start: time.Now()}
+		if err := store.Save(record); err != nil {
+			t.Errorf("Save(%q): %s", name, err)
+		}
+		records, err := store.History(name, name, 0)
+		if err != nil || len(records) != 1 || records[0].Target != name {
+			t.Errorf("History(%q) = %v, %v", name, records, err)
+		}
+	}
+	if err := store.Save(&ScanRecord{Target: "host", Start: time.Now()}); err == nil {
+		t.Errorf("Save with empty module succeeded")
+	}
+
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			if rel, _ := filepath.Rel(store.path, path); strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				t.Errorf("record %s written outside the store", path)
+			}
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResultStorePruneKeepsForeignFiles(t *testing.T) {
+	root, err := ioutil.TempDir("", "inspec_exporter_store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	store, err := NewResultStore(root, time.Hour, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := store.dir("host", "module")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		t.Fatal(err)
+	}
+	foreign := filepath.Join(dir, "notes.json")
+	if err := ioutil.WriteFile(foreign, []byte("{}"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for _, start := range []time.Time{now.Add(-2 * time.Hour), now.Add(-2 * time.Minute), now.Add(-time.Minute), now} {
+		if err := store.Save(&ScanRecord{Target: "host", Module: "module", Start: start}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	records, err := store.History("host", "module", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || !records[0].Start.Equal(now) {
+		t.Errorf("History = %d records, want the 2 newest", len(records))
+	}
+	if _, err := os.Stat(foreign); err != nil {
+		t.Errorf("prune removed a foreign file: %s", err)
+	}
+}
+
+func TestResultStorePrunesOtherModulesOnOpen(t *testing.T) {
+	root, err := ioutil.TempDir("", "inspec_exporter_store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	store, err := NewResultStore(root, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for _, record := range []*ScanRecord{
+		{Target: "old", Module: "module", Start: now.Add(-2 * time.Hour)},
+		{Target: "host", Module: "module", Start: now.Add(-2 * time.Hour)},
+		{Target: "host", Module: "module", Start: now},
+	} {
+		if err := store.Save(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store, err = NewResultStore(root, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets, err := store.Targets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 1 || targets[0] != "host" {
+		t.Errorf("Targets = %v, want [host]", targets)
+	}
+	records, err := store.History("host", "module", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || !records[0].Start.Equal(now) {
+		t.Errorf("History = %d records, want the newest", len(records))
+	}
+}
+
+func TestResultStoreWindow(t *testing.T) {
+	root, err := ioutil.TempDir("", "inspec_exporter_store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	store, err := NewResultStore(root, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := store.Window("host", "module", time.Hour, 2)
+	if err != nil || len(records) != 0 {
+		t.Errorf("Window of an empty store = %v, %v", records, err)
+	}
+
+	newest := time.Now()
+	for _, age := range []time.Duration{5 * time.Hour, 4 * time.Hour, 3 * time.Hour, 30 * time.Minute, 0} {
+		if err := store.Save(&ScanRecord{Target: "host", Module: "module", Start: newest.Add(-age)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, test := range []struct {
+		window time.Duration
+		min    int
+		want   int
+	}{
+		{time.Hour, 0, 2},
+		{time.Hour, 3, 3},
+		{time.Minute, 2, 2},
+		{-time.Hour, 0, 0},
+		{24 * time.Hour, 2, 5},
+	} {
+		records, err := store.Window("host", "module", test.window, test.min)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != test.want {
+			t.Errorf("Window(%s, %d) = %d records, want %d", test.window, test.min, len(records), test.want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+// pageStyle is shared by all HTML pages, which must not load external assets.
+const pageStyle = `
+            <style>
+            body { font-family: sans-serif; margin: 20px; }
+            table { border-collapse: collapse; }
+            th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+            .passed { background: #dff0d8; }
+            .failed { background: #f2dede; }
+            .skipped { background: #fcf8e3; }
+            .error { background: #f5c6cb; }
+            .message { white-space: pre-wrap; font-family: monospace; }
+            </style>`
+
+const reportHTML = `<html>
+            <head>
+            <title>inspec Report {{.Module}} {{.Target}}</title>` + pageStyle + `
+            </head>
+            <body>
+            	<h1>{{.Module}} on {{if .Target}}{{.Target}}{{else}}local{{end}}</h1>
+            	<p>Scan of {{.Start.Format "2006-01-02 15:04:05 MST"}} took {{printf "%.1f" .Duration}}s, exit status {{.ExitStatus}}.</p>
+            	{{if .Error}}<p class="error">Error: {{.Error}}</p>{{end}}
+            	<h2>Score {{printf "%.1f" .Score}}%</h2>
+            	<table>
+            		<tr class="passed"><th>Passed</th><td>{{.Passed}}</td></tr>
+            		<tr class="failed"><th>Failed</th><td>{{.Failed}}</td></tr>
+            		<tr class="skipped"><th>Skipped</th><td>{{.Skipped}}</td></tr>
+            	</table>
+            	{{if .HasPrevious}}<p><a href="/api/v1/diff?target={{.Target}}&module={{.Module}}">Changes since the previous scan</a></p>{{end}}
+            	{{range .Profiles}}
+            	<h2>Profile {{.Name}}</h2>
+            	{{range .Groups}}
+            	<h3>{{.Status}} ({{len .Controls}})</h3>
+            	<table>
+            		<tr><th>Control</th><th>Result</th><th>Message</th></tr>
+            		{{range .Controls}}{{$control := .}}{{range .Results}}
+            		<tr class="{{.Status}}">
+            			<td>{{$control.ID}}</td>
+            			<td>{{.CodeDesc}}</td>
+            			<td class="message">{{if .Message}}{{.Message}}{{else}}{{.SkipMessage}}{{end}}</td>
+            		</tr>
+            		{{end}}{{end}}
+            	</table>
+            	{{end}}
+            	{{end}}
+            	<p><a href="/">Back</a></p>
+            </body>
+            </html>`
+
+const matrixHTML = `<html>
+            <head>
+            <title>inspec Compliance Matrix</title>` + pageStyle + `
+            </head>
+            <body>
+            	<h1>Compliance Matrix</h1>
+            	<p>Sort by <a href="?sort=target">target</a> | <a href="?sort=ratio">worst pass ratio</a> | <a href="?sort=age">oldest scan</a></p>
+            	<table>
+            		<tr><th>Target</th>{{range .Modules}}<th>{{.}}</th>{{end}}</tr>
+            		{{range .Rows}}{{$target := .Target}}
+            		<tr>
+            			<th>{{if $target}}{{$target}}{{else}}local{{end}}</th>
+            			{{range .Cells}}
+            			<td class="{{.Class}}">{{if .Found}}
+            				<a href="/report?target={{$target}}&module={{.Module}}">{{printf "%.1f" .Ratio}}%</a><br>
+            				{{.Age}} ago{{if .Error}}<br>error{{end}}
+            			{{end}}</td>
+            			{{end}}
+            		</tr>
+            		{{end}}
+            	</table>
+            	<p><a href="/">Back</a></p>
+            </body>
+            </html>`
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/prometheus/common/log"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	textfileCommand   = kingpin.Command("textfile", "Scan the local host once and write the metrics for the node_exporter textfile collector.")
+	textfileDirectory = textfileCommand.Flag("textfile.directory", "Directory of the node_exporter textfile collector.").Required().String()
+	textfileModules   = textfileCommand.Flag("module", "Module to run, can be repeated (DEFAULT: all modules).").Strings()
+)
+
+// writeFileAtomic writes the file via a temporary file in the same
+// directory, so readers never see a partial file.
+func writeFileAtomic(file string, content []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(file), "."+filepath.Base(file))
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// runTextfile implements the textfile command and returns the exit code.
+// Every module is written to inspec_<module>.prom, a failed scan keeps the
+// previous file.
+func runTextfile() int {
+	modules := *textfileModules
+	if len(modules) == 0 {
+		names, err := moduleNames()
+		if err != nil {
+			log.Errorf("'profile_path' is not readable: %s", err)
+			return 2
+		}
+		modules = names
+	}
+
+	exitCode := 0
+	for _, module := range modules {
+		if !moduleExists(module) {
+			log.Errorf("Unkown module '%s'", module)
+			exitCode = 2
+			continue
+		}
+		m := loadModule(module)
+		content, err := gatherText(collector{module: &m})
+		if err != nil {
+			log.Errorf("Error scanning with module %s: %s", module, err)
+			exitCode = 1
+			continue
+		}
+		file := filepath.Join(*textfileDirectory, "inspec_"+normalize(module)+".prom")
+		if err := writeFileAtomic(file, content); err != nil {
+			log.Errorf("Error writing %s: %s", file, err)
+			exitCode = 1
+			continue
+		}
+		log.Infof("Wrote %s", file)
+	}
+	return exitCode
+}